@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/worker"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type redisConfig struct {
+	Addr     string `json:"addr"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+}
+
+type networkConfig struct {
+	Name string   `json:"name"`
+	RPCs []string `json:"rpcs"`
+	// optional gas policy, in wei
+	MaxFeePerGas string `json:"maxFeePerGas"`
+	HourlyBudget string `json:"hourlyBudget"`
+	DailyBudget  string `json:"dailyBudget"`
+	// optional address receiving every execute fee
+	Treasury string `json:"treasury"`
+	// optional contracts whose orders are discovered from their logs
+	Scanners []scannerConfig `json:"scanners"`
+}
+
+// scannerConfig only checks the cancel of the orders, the worker has no scanner.QuoteFunc
+type scannerConfig struct {
+	Contract string `json:"contract"`
+	// an account of the keystore
+	Keeper string `json:"keeper"`
+	// the head of the chain on the first run when 0, then the checkpoint in redis
+	FromBlock     uint64 `json:"fromBlock"`
+	Confirmations uint64 `json:"confirmations"`
+	ReorgDepth    uint64 `json:"reorgDepth"`
+	MaxBlockRange uint64 `json:"maxBlockRange"`
+	BatchSize     int    `json:"batchSize"`
+	// Multicall3 at its usual address when empty
+	Multicall string `json:"multicall"`
+	// checkUpkeep is called once per order from the keeper, for the contracts reading msg.sender
+	DirectCheck bool     `json:"directCheck"`
+	Interval    duration `json:"interval"`
+	Queue       string   `json:"queue"`
+}
+
+// orderTypeConfig is an order type of the contract
+type orderTypeConfig struct {
+	ID                    uint64 `json:"id"`
+	Name                  string `json:"name"`
+	RequiresRoutes        bool   `json:"requiresRoutes"`
+	CancelOnlyWhenExpired bool   `json:"cancelOnlyWhenExpired"`
+	RequiresTrigger       bool   `json:"requiresTrigger"`
+}
+
+type keystoreConfig struct {
+	Path string `json:"path"`
+	// the passphrase is read from the environment variable or the file, never from the config
+	PassphraseEnv  string `json:"passphraseEnv"`
+	PassphraseFile string `json:"passphraseFile"`
+}
+
+type config struct {
+	Redis       redisConfig `json:"redis"`
+	Concurrency int         `json:"concurrency"`
+	// tasks processed at once per network and per keeper, unlimited when 0
+	NetworkConcurrency int `json:"networkConcurrency"`
+	KeeperConcurrency  int `json:"keeperConcurrency"`
+	// deadline of the tasks enqueued without their own, 30 minutes of asynq when empty
+	TaskTimeout    duration        `json:"taskTimeout"`
+	Queues         map[string]int  `json:"queues"`
+	StrictPriority bool            `json:"strictPriority"`
+	Networks       []networkConfig `json:"networks"`
+	Keystore       keystoreConfig  `json:"keystore"`
+	// direct or optimize
+	Mode string `json:"mode"`
+	// the order types of the contract, every type is accepted without them
+	OrderTypes []orderTypeConfig `json:"orderTypes"`
+	// journal the sent transactions in redis
+	Journal bool `json:"journal"`
+	// listen address of the health and metrics endpoints, disabled when empty
+	HTTPAddr string `json:"httpAddr"`
+	// serve the api.Server on httpAddr with the comma separated keys of the environment variable
+	APIKeysEnv string `json:"apiKeysEnv"`
+	// sign the callbacks with the secret of the environment variable, the api rejects a callbackUrl without it
+	WebhookSecretEnv string   `json:"webhookSecretEnv"`
+	ShutdownTimeout  duration `json:"shutdownTimeout"`
+	// debug, info, warn or error, info by default
+	LogLevel string `json:"logLevel"`
+}
+
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+func (cfg *config) validate() error {
+	if cfg.Redis.Addr == "" {
+		return errors.New("redis.addr is required")
+	}
+	if len(cfg.Networks) == 0 {
+		return errors.New("at least one network is required")
+	}
+	for _, n := range cfg.Networks {
+		if n.Name == "" {
+			return errors.New("network name is required")
+		}
+		if len(n.RPCs) == 0 {
+			return fmt.Errorf("network %s requires at least one rpc", n.Name)
+		}
+		for _, v := range []string{n.MaxFeePerGas, n.HourlyBudget, n.DailyBudget} {
+			if _, err := parseWei(v); err != nil {
+				return fmt.Errorf("network %s: %w", n.Name, err)
+			}
+		}
+		if n.Treasury != "" && !common.IsHexAddress(n.Treasury) {
+			return fmt.Errorf("network %s: invalid treasury %s", n.Name, n.Treasury)
+		}
+		for _, sc := range n.Scanners {
+			if err := cfg.validateScanner(&sc); err != nil {
+				return fmt.Errorf("network %s: scanner %s: %w", n.Name, sc.Contract, err)
+			}
+		}
+	}
+	if cfg.Keystore.Path == "" {
+		return errors.New("keystore.path is required")
+	}
+	if cfg.Keystore.PassphraseEnv == "" && cfg.Keystore.PassphraseFile == "" {
+		return errors.New("keystore.passphraseEnv or keystore.passphraseFile is required")
+	}
+	if _, err := cfg.mode(); err != nil {
+		return err
+	}
+	if _, err := cfg.logLevel(); err != nil {
+		return err
+	}
+	if cfg.NetworkConcurrency < 0 || cfg.KeeperConcurrency < 0 {
+		return errors.New("networkConcurrency and keeperConcurrency must not be negative")
+	}
+	if cfg.TaskTimeout < 0 {
+		return errors.New("taskTimeout must not be negative")
+	}
+	for _, ot := range cfg.OrderTypes {
+		if ot.Name == "" {
+			return fmt.Errorf("order type %d has no name", ot.ID)
+		}
+	}
+	if cfg.APIKeysEnv != "" && cfg.HTTPAddr == "" {
+		return errors.New("apiKeysEnv requires httpAddr")
+	}
+	return nil
+}
+
+func (cfg *config) validateScanner(sc *scannerConfig) error {
+	if !common.IsHexAddress(sc.Contract) {
+		return errors.New("invalid contract")
+	}
+	if !common.IsHexAddress(sc.Keeper) {
+		return errors.New("invalid keeper")
+	}
+	if sc.Multicall != "" && !common.IsHexAddress(sc.Multicall) {
+		return errors.New("invalid multicall")
+	}
+	if sc.Interval < 0 || sc.BatchSize < 0 {
+		return errors.New("interval and batchSize must not be negative")
+	}
+	if _, ok := cfg.Queues[sc.Queue]; sc.Queue != "" && len(cfg.Queues) > 0 && !ok {
+		return fmt.Errorf("queue %s is not processed", sc.Queue)
+	}
+	return nil
+}
+
+func (cfg *config) hasScanners() bool {
+	for _, n := range cfg.Networks {
+		if len(n.Scanners) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeys returns nil when the api is disabled
+func (cfg *config) apiKeys() ([]string, error) {
+	if cfg.APIKeysEnv == "" {
+		return nil, nil
+	}
+	var keys []string
+	for _, key := range strings.Split(os.Getenv(cfg.APIKeysEnv), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("environment variable %s has no api key", cfg.APIKeysEnv)
+	}
+	return keys, nil
+}
+
+// registerOrderTypes registers the order types of the config
+func (cfg *config) registerOrderTypes() error {
+	for _, ot := range cfg.OrderTypes {
+		if err := order.RegisterOrderType(order.OrderTypeSpec{
+			ID:                    ot.ID,
+			Name:                  ot.Name,
+			RequiresRoutes:        ot.RequiresRoutes,
+			CancelOnlyWhenExpired: ot.CancelOnlyWhenExpired,
+			RequiresTrigger:       ot.RequiresTrigger,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// webhookSecret returns nil when the callbacks are disabled
+func (cfg *config) webhookSecret() ([]byte, error) {
+	if cfg.WebhookSecretEnv == "" {
+		return nil, nil
+	}
+	secret := os.Getenv(cfg.WebhookSecretEnv)
+	if secret == "" {
+		return nil, fmt.Errorf("environment variable %s has no webhook secret", cfg.WebhookSecretEnv)
+	}
+	return []byte(secret), nil
+}
+
+func (cfg *config) logLevel() (slog.Level, error) {
+	var level slog.Level
+	if cfg.LogLevel == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return 0, fmt.Errorf("invalid logLevel: %w", err)
+	}
+	return level, nil
+}
+
+func (cfg *config) mode() (worker.Mode, error) {
+	switch cfg.Mode {
+	case "", "direct":
+		return worker.ModeDirect, nil
+	case "optimize":
+		return worker.ModeOptimize, nil
+	}
+	return 0, fmt.Errorf("unknown mode %q", cfg.Mode)
+}
+
+func (cfg *keystoreConfig) passphrase() (string, error) {
+	if cfg.PassphraseEnv != "" {
+		if v, ok := os.LookupEnv(cfg.PassphraseEnv); ok {
+			return v, nil
+		}
+		if cfg.PassphraseFile == "" {
+			return "", fmt.Errorf("environment variable %s is not set", cfg.PassphraseEnv)
+		}
+	}
+	data, err := os.ReadFile(cfg.PassphraseFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// parseWei returns nil for an empty value
+func parseWei(v string) (*big.Int, error) {
+	if v == "" {
+		return nil, nil
+	}
+	n, ok := new(big.Int).SetString(v, 10)
+	if !ok || n.Sign() < 0 {
+		return nil, fmt.Errorf("invalid wei amount %q", v)
+	}
+	return n, nil
+}
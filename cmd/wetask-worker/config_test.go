@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/worker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := loadConfig("wetask-worker.example.json")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:6379", cfg.Redis.Addr)
+	assert.Equal(t, 6, cfg.Queues["critical"])
+	assert.Equal(t, 30*time.Second, time.Duration(cfg.ShutdownTimeout))
+	assert.Equal(t, 10*time.Minute, time.Duration(cfg.TaskTimeout))
+	assert.Equal(t, 1, cfg.KeeperConcurrency)
+	mode, err := cfg.mode()
+	assert.NoError(t, err)
+	assert.Equal(t, worker.ModeOptimize, mode)
+	if assert.Len(t, cfg.Networks[0].Scanners, 1) {
+		sc := cfg.Networks[0].Scanners[0]
+		assert.Equal(t, uint64(3), sc.Confirmations)
+		assert.Equal(t, 15*time.Second, time.Duration(sc.Interval))
+	}
+	assert.True(t, cfg.hasScanners())
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"no redis":       `{"networks":[{"name":"sepolia","rpcs":["http://x"]}],"keystore":{"path":"k","passphraseEnv":"P"}}`,
+		"no rpc":         `{"redis":{"addr":"r"},"networks":[{"name":"sepolia"}],"keystore":{"path":"k","passphraseEnv":"P"}}`,
+		"bad wei":        `{"redis":{"addr":"r"},"networks":[{"name":"sepolia","rpcs":["http://x"],"maxFeePerGas":"1e9"}],"keystore":{"path":"k","passphraseEnv":"P"}}`,
+		"passphrase":     `{"redis":{"addr":"r"},"networks":[{"name":"sepolia","rpcs":["http://x"]}],"keystore":{"path":"k"}}`,
+		"bad mode":       `{"redis":{"addr":"r"},"networks":[{"name":"sepolia","rpcs":["http://x"]}],"keystore":{"path":"k","passphraseEnv":"P"},"mode":"fast"}`,
+		"api no http":    `{"redis":{"addr":"r"},"networks":[{"name":"sepolia","rpcs":["http://x"]}],"keystore":{"path":"k","passphraseEnv":"P"},"apiKeysEnv":"K"}`,
+		"bad level":      `{"redis":{"addr":"r"},"networks":[{"name":"sepolia","rpcs":["http://x"]}],"keystore":{"path":"k","passphraseEnv":"P"},"logLevel":"loud"}`,
+		"negative":       `{"redis":{"addr":"r"},"networks":[{"name":"sepolia","rpcs":["http://x"]}],"keystore":{"path":"k","passphraseEnv":"P"},"keeperConcurrency":-1}`,
+		"bad treasury":   `{"redis":{"addr":"r"},"networks":[{"name":"sepolia","rpcs":["http://x"],"treasury":"0x12"}],"keystore":{"path":"k","passphraseEnv":"P"}}`,
+		"bad scanner":    `{"redis":{"addr":"r"},"networks":[{"name":"sepolia","rpcs":["http://x"],"scanners":[{"contract":"0xc0ff","keeper":"0x0000000000000000000000000000000000001234"}]}],"keystore":{"path":"k","passphraseEnv":"P"}}`,
+		"bad queue":      `{"redis":{"addr":"r"},"queues":{"default":1},"networks":[{"name":"sepolia","rpcs":["http://x"],"scanners":[{"contract":"0x000000000000000000000000000000000000c0ff","keeper":"0x0000000000000000000000000000000000001234","queue":"low"}]}],"keystore":{"path":"k","passphraseEnv":"P"}}`,
+		"bad order type": `{"redis":{"addr":"r"},"networks":[{"name":"sepolia","rpcs":["http://x"]}],"keystore":{"path":"k","passphraseEnv":"P"},"orderTypes":[{"id":1}]}`,
+		"bad timeout":    `{"redis":{"addr":"r"},"networks":[{"name":"sepolia","rpcs":["http://x"]}],"keystore":{"path":"k","passphraseEnv":"P"},"shutdownTimeout":"soon"}`,
+	} {
+		path := filepath.Join(dir, "config.json")
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		_, err := loadConfig(path)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	keys, err := (&config{}).apiKeys()
+	assert.NoError(t, err)
+	assert.Nil(t, keys)
+
+	t.Setenv("WETASK_TEST_API_KEYS", " a, b ,,")
+	keys, err = (&config{APIKeysEnv: "WETASK_TEST_API_KEYS"}).apiKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
+
+	_, err = (&config{APIKeysEnv: "WETASK_TEST_UNSET"}).apiKeys()
+	assert.Error(t, err)
+}
+
+func TestWebhookSecret(t *testing.T) {
+	secret, err := (&config{}).webhookSecret()
+	assert.NoError(t, err)
+	assert.Nil(t, secret)
+
+	t.Setenv("WETASK_TEST_WEBHOOK_SECRET", "s3cret")
+	secret, err = (&config{WebhookSecretEnv: "WETASK_TEST_WEBHOOK_SECRET"}).webhookSecret()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("s3cret"), secret)
+
+	_, err = (&config{WebhookSecretEnv: "WETASK_TEST_UNSET"}).webhookSecret()
+	assert.Error(t, err)
+}
+
+func TestKeystorePassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passphrase")
+	assert.NoError(t, os.WriteFile(path, []byte("from file\n"), 0o600))
+
+	t.Setenv("WETASK_TEST_PASSPHRASE", "from env")
+	v, err := (&keystoreConfig{PassphraseEnv: "WETASK_TEST_PASSPHRASE", PassphraseFile: path}).passphrase()
+	assert.NoError(t, err)
+	assert.Equal(t, "from env", v)
+
+	v, err = (&keystoreConfig{PassphraseEnv: "WETASK_TEST_UNSET", PassphraseFile: path}).passphrase()
+	assert.NoError(t, err)
+	assert.Equal(t, "from file", v)
+
+	_, err = (&keystoreConfig{PassphraseEnv: "WETASK_TEST_UNSET"}).passphrase()
+	assert.Error(t, err)
+}
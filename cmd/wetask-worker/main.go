@@ -0,0 +1,290 @@
+// Command wetask-worker runs the keeper tasks, the API and the scanners of the networks.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/api"
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/WEPublicGoods/wetask/pkg/metrics"
+	"github.com/WEPublicGoods/wetask/pkg/notify"
+	"github.com/WEPublicGoods/wetask/pkg/pool"
+	"github.com/WEPublicGoods/wetask/pkg/scanner"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/WEPublicGoods/wetask/pkg/tasks/order/limit_keeper"
+	"github.com/WEPublicGoods/wetask/pkg/worker"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func main() {
+	configPath := flag.String("config", "wetask-worker.json", "path of the config file")
+	flag.Parse()
+
+	if err := run(*configPath); err != nil {
+		slog.Error("wetask-worker failed", slog.String("error", eclient.RedactURLs(err.Error())))
+		os.Exit(1)
+	}
+}
+
+func run(configPath string) error {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if err := cfg.registerOrderTypes(); err != nil {
+		return err
+	}
+	level, _ := cfg.logLevel()
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: eclient.RedactAttr,
+	}))
+	// the W3C trace context of the API callers is carried by the payloads
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	wallet, err := openWallet(&cfg.Keystore)
+	if err != nil {
+		return err
+	}
+	mode, _ := cfg.mode()
+	redisOpt := asynq.RedisClientOpt{
+		Addr:     cfg.Redis.Addr,
+		Username: cfg.Redis.Username,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	}
+
+	var rdb *redis.Client
+	if cfg.Journal || cfg.hasScanners() {
+		rdb = redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Username: cfg.Redis.Username,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		defer rdb.Close()
+	}
+
+	clients := make([]eclient.Ethclient, 0, len(cfg.Networks))
+	opts := []worker.Option{worker.WithMode(mode), worker.WithContext(func(ctx context.Context) context.Context {
+		return pool.WithLogger(ctx, logger)
+	})}
+	for _, n := range cfg.Networks {
+		client := eclient.NewEthclientPool(n.Name, n.RPCs...).Use(metrics.ObserveRPC, eclient.TraceRPC).WithLogger(logger)
+		defer client.Close()
+		clients = append(clients, client)
+		maxFeePerGas, _ := parseWei(n.MaxFeePerGas)
+		hourly, _ := parseWei(n.HourlyBudget)
+		daily, _ := parseWei(n.DailyBudget)
+		if maxFeePerGas != nil || hourly != nil || daily != nil {
+			policy := pool.GasPolicy{MaxFeePerGas: maxFeePerGas, HourlyBudget: hourly, DailyBudget: daily}
+			name := n.Name
+			opts = append(opts, worker.WithContext(func(ctx context.Context) context.Context {
+				return pool.WithGasPolicy(ctx, name, policy)
+			}))
+		}
+		if n.Treasury != "" {
+			treasury, name := common.HexToAddress(n.Treasury), n.Name
+			opts = append(opts, worker.WithContext(func(ctx context.Context) context.Context {
+				return limit_keeper.WithTreasury(ctx, name, treasury)
+			}))
+		}
+	}
+	webhookSecret, err := cfg.webhookSecret()
+	if err != nil {
+		return err
+	}
+	if webhookSecret != nil {
+		notifier := notify.NewWebhook(webhookSecret)
+		opts = append(opts, worker.WithContext(func(ctx context.Context) context.Context {
+			return limit_keeper.WithNotifier(ctx, notifier)
+		}))
+	}
+	if cfg.Journal {
+		journal := limit_keeper.NewRedisJournal(rdb, "", 0)
+		opts = append(opts, worker.WithContext(func(ctx context.Context) context.Context {
+			return limit_keeper.WithJournal(ctx, journal)
+		}))
+	}
+
+	var scanners []*scanner.Scanner
+	scanCtx := func(ctx context.Context) context.Context { return ctx }
+	if cfg.hasScanners() {
+		client := asynq.NewClient(redisOpt)
+		defer client.Close()
+		// replaces the finished tasks of the orders callable again
+		inspector := asynq.NewInspector(redisOpt)
+		defer inspector.Close()
+		scanCtx = func(ctx context.Context) context.Context {
+			return tasks.WithInspector(ctx, inspector)
+		}
+		checkpoint := scanner.NewRedisCheckpoint(rdb, "")
+		for i, n := range cfg.Networks {
+			for _, sc := range n.Scanners {
+				s, err := newScanner(clients[i], wallet, client, checkpoint, &sc)
+				if err != nil {
+					return fmt.Errorf("network %s: scanner %s: %w", n.Name, sc.Contract, err)
+				}
+				scanners = append(scanners, s)
+			}
+		}
+	}
+
+	srv := worker.NewServer(worker.Config{
+		Config: asynq.Config{
+			Concurrency:     cfg.Concurrency,
+			Queues:          cfg.Queues,
+			StrictPriority:  cfg.StrictPriority,
+			ShutdownTimeout: time.Duration(cfg.ShutdownTimeout),
+			Logger:          worker.NewLogger(logger),
+			LogLevel:        asynqLogLevel(level),
+		},
+		Redis:   redisOpt,
+		Clients: clients,
+		Wallet:  wallet,
+	}, opts...)
+	// the first middleware is the outermost, a recovered panic is still counted
+	srv.Mux.Use(metrics.Middleware, tasks.Recover)
+	if cfg.TaskTimeout > 0 {
+		srv.Mux.Use(tasks.Timeout(time.Duration(cfg.TaskTimeout)))
+	}
+	srv.Mux.Use(tasks.NewLimiter(cfg.NetworkConcurrency, cfg.KeeperConcurrency).Middleware)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var httpSrv *http.Server
+	if cfg.HTTPAddr != "" {
+		apiKeys, err := cfg.apiKeys()
+		if err != nil {
+			return err
+		}
+		var apiHandler http.Handler
+		if apiKeys != nil {
+			client := asynq.NewClient(redisOpt)
+			defer client.Close()
+			inspector := asynq.NewInspector(redisOpt)
+			defer inspector.Close()
+			apiSrv := api.NewServer(client, inspector, apiKeys)
+			apiSrv.Callbacks = webhookSecret != nil
+			apiHandler = apiSrv.Handler()
+		}
+		httpSrv = &http.Server{Addr: cfg.HTTPAddr, Handler: newHTTPHandler(srv, apiHandler)}
+		go func() {
+			if err := httpSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("http server failed", slog.Any("error", err))
+				stop()
+			}
+		}()
+	}
+
+	if err := srv.Start(); err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for _, s := range scanners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Run(scanCtx(pool.WithLogger(ctx, logger)))
+		}()
+	}
+	<-ctx.Done()
+	logger.Info("shutting down")
+	wg.Wait()
+	srv.Shutdown()
+	if httpSrv != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return httpSrv.Shutdown(shutdownCtx)
+	}
+	return nil
+}
+
+func asynqLogLevel(level slog.Level) asynq.LogLevel {
+	switch {
+	case level <= slog.LevelDebug:
+		return asynq.DebugLevel
+	case level <= slog.LevelInfo:
+		return asynq.InfoLevel
+	case level <= slog.LevelWarn:
+		return asynq.WarnLevel
+	}
+	return asynq.ErrorLevel
+}
+
+func newScanner(client eclient.Ethclient, wallet *keystore.KeyStore, enqueuer tasks.Enqueuer, checkpoint scanner.Checkpoint, sc *scannerConfig) (*scanner.Scanner, error) {
+	keeper := common.HexToAddress(sc.Keeper)
+	if !wallet.HasAddress(keeper) {
+		return nil, fmt.Errorf("keeper %s is not in the keystore", keeper.Hex())
+	}
+	var multicall common.Address
+	if sc.Multicall != "" {
+		multicall = common.HexToAddress(sc.Multicall)
+	}
+	return scanner.New(scanner.Config{
+		Client:                      client,
+		AutomationCompatibleAddress: common.HexToAddress(sc.Contract),
+		Keeper:                      keeper,
+		Enqueuer:                    enqueuer,
+		Checkpoint:                  checkpoint,
+		FromBlock:                   sc.FromBlock,
+		Confirmations:               sc.Confirmations,
+		ReorgDepth:                  sc.ReorgDepth,
+		MaxBlockRange:               sc.MaxBlockRange,
+		BatchSize:                   sc.BatchSize,
+		Multicall:                   multicall,
+		DirectCheck:                 sc.DirectCheck,
+		Interval:                    time.Duration(sc.Interval),
+		Queue:                       sc.Queue,
+	})
+}
+
+// openWallet unlocks every account of the keystore with the configured passphrase
+func openWallet(cfg *keystoreConfig) (*keystore.KeyStore, error) {
+	passphrase, err := cfg.passphrase()
+	if err != nil {
+		return nil, fmt.Errorf("read keystore passphrase: %w", err)
+	}
+	wallet := keystore.NewKeyStore(cfg.Path, keystore.StandardScryptN, keystore.StandardScryptP)
+	if len(wallet.Accounts()) == 0 {
+		return nil, fmt.Errorf("no account in keystore %s", cfg.Path)
+	}
+	for _, account := range wallet.Accounts() {
+		if err := wallet.Unlock(account, passphrase); err != nil {
+			return nil, fmt.Errorf("unlock %s: %w", account.Address.Hex(), err)
+		}
+	}
+	return wallet, nil
+}
+
+// newHTTPHandler serves the api on the other paths when apiHandler is not nil
+func newHTTPHandler(srv *worker.Server, apiHandler http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	if apiHandler != nil {
+		mux.Handle("/", apiHandler)
+	}
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := srv.Ping(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("GET /metrics", metrics.Handler())
+	return mux
+}
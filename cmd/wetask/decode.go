@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/com"
+	ethorder "github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/tasks/order/limit_keeper"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// decodedOrderData is printed with the fields of the input and isExpired
+type decodedOrderData struct {
+	ethorder.LimitOrderExecuteInput
+	IsExpired bool
+}
+
+func runDecode(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	var tf taskFlags
+	tf.register(fs)
+	data := fs.String("data", "", "hex of an orderData or a performUpkeep calldata, instead of a task")
+	treasury := fs.String("treasury", "", "treasury of the worker on the network of the task, paid the execute fees")
+	fs.Parse(args)
+	if *treasury != "" && !common.IsHexAddress(*treasury) {
+		return fmt.Errorf("invalid -treasury %s", *treasury)
+	}
+
+	if *data != "" {
+		raw, err := hexutil.Decode(*data)
+		if err != nil {
+			return err
+		}
+		decoded, err := decodeOrderData(raw)
+		if err != nil {
+			return err
+		}
+		return printJSON(w, decoded)
+	}
+
+	task, err := tf.task()
+	if err != nil {
+		return err
+	}
+	d, err := limit_keeper.DecodeTask(task)
+	if err != nil {
+		return err
+	}
+	out := map[string]interface{}{"type": d.Type, "payload": d.Payload}
+	if *treasury != "" {
+		// packed again like the worker of the network
+		ctx := limit_keeper.WithTreasury(context.Background(), d.NetworkName, common.HexToAddress(*treasury))
+		if d, err = limit_keeper.DecodeTaskContext(ctx, task); err != nil {
+			return err
+		}
+	} else {
+		out["note"] = "the orderData is packed without a treasury, set -treasury when the worker has one for the network"
+	}
+	decoded, err := decodeOrderData(d.OrderData)
+	if err != nil {
+		return err
+	}
+	out["orderData"], out["decodedOrderData"] = hexutil.Encode(d.OrderData), decoded
+	return printJSON(w, out)
+}
+
+// decodeOrderData unpacks the LimitOrderExecuteInput of data, unwrapping a performUpkeep calldata
+func decodeOrderData(data []byte) (*decodedOrderData, error) {
+	parsed, err := com.AutomationCompatibleMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	method := parsed.Methods["performUpkeep"]
+	if len(data) >= 4 && bytes.Equal(data[:4], method.ID) {
+		args, err := method.Inputs.Unpack(data[4:])
+		if err != nil {
+			return nil, fmt.Errorf("unpack performUpkeep: %w", err)
+		}
+		data = args[0].([]byte)
+	}
+	in, isExpired, err := ethorder.DecodeLimitOrderExecuteInput(data)
+	if err != nil {
+		return nil, fmt.Errorf("unpack orderData: %w", err)
+	}
+	return &decodedOrderData{LimitOrderExecuteInput: *in, IsExpired: isExpired}, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/com"
+	ethorder "github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/WEPublicGoods/wetask/pkg/tasks/order/limit_keeper"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	task, err := limit_keeper.NewNormalTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", ethorder.LimitOrderExecuteInput{
+		Order: ethorder.Order{
+			Account:    common.HexToAddress("0x1111111111111111111111111111111111111111"),
+			Index:      big.NewInt(1),
+			OrderType:  big.NewInt(0),
+			ExecuteFee: big.NewInt(100),
+		},
+		TokenIn:           common.HexToAddress("0x2222222222222222222222222222222222222222"),
+		TokenOut:          common.HexToAddress("0x3333333333333333333333333333333333333333"),
+		RemainingAmountIn: big.NewInt(1000),
+		AmountIn:          big.NewInt(1000),
+		AmountOutMin:      big.NewInt(900),
+		AmountOutExpected: big.NewInt(950),
+		Routes: []ethorder.SwapRoute{{
+			DexId:        1,
+			TokenIn:      common.HexToAddress("0x2222222222222222222222222222222222222222"),
+			TokenOut:     common.HexToAddress("0x3333333333333333333333333333333333333333"),
+			AmountIn:     big.NewInt(1000),
+			AmountOutMin: big.NewInt(900),
+		}},
+	})
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "payload.json")
+	assert.NoError(t, os.WriteFile(path, task.Payload(), 0o600))
+
+	var out bytes.Buffer
+	assert.NoError(t, runDecode([]string{"-type", tasks.ACT_LIMIT_ORDER, "-payload", path}, &out))
+	var got struct {
+		Type             string
+		Note             string
+		OrderData        string
+		DecodedOrderData map[string]json.RawMessage
+	}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.Equal(t, tasks.ACT_LIMIT_ORDER, got.Type)
+	assert.JSONEq(t, "1000", string(got.DecodedOrderData["amountIn"]))
+	assert.JSONEq(t, "false", string(got.DecodedOrderData["isExpired"]))
+	assert.JSONEq(t, `"0x0000000000000000000000000000000000001234"`, string(got.DecodedOrderData["feeReceiver"]))
+	assert.NotEmpty(t, got.Note)
+
+	// the fees paid to the treasury of the worker
+	var treasury bytes.Buffer
+	assert.NoError(t, runDecode([]string{"-type", tasks.ACT_LIMIT_ORDER, "-payload", path, "-treasury", "0x0000000000000000000000000000000000007777"}, &treasury))
+	var withTreasury struct {
+		Note             string
+		DecodedOrderData map[string]json.RawMessage
+	}
+	assert.NoError(t, json.Unmarshal(treasury.Bytes(), &withTreasury))
+	assert.JSONEq(t, `"0x0000000000000000000000000000000000007777"`, string(withTreasury.DecodedOrderData["feeReceiver"]))
+	assert.Empty(t, withTreasury.Note)
+
+	// the calldata of performUpkeep
+	orderData, err := hexutil.Decode(got.OrderData)
+	assert.NoError(t, err)
+	parsed, err := com.AutomationCompatibleMetaData.GetAbi()
+	assert.NoError(t, err)
+	input, err := parsed.Pack("performUpkeep", orderData)
+	assert.NoError(t, err)
+	out.Reset()
+	assert.NoError(t, runDecode([]string{"-data", hexutil.Encode(input)}, &out))
+	var decoded map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.JSONEq(t, "950", string(decoded["amountOutExpected"]))
+}
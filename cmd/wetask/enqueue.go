@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	ethorder "github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/WEPublicGoods/wetask/pkg/tasks/order/limit_keeper"
+	"github.com/hibiken/asynq"
+	"github.com/tinkler/moonmist/pkg/jsonz/cjson"
+)
+
+func runEnqueue(args []string, w io.Writer) error {
+	if len(args) == 0 || (args[0] != "limit" && args[0] != "twap" && args[0] != "cancel") {
+		return fmt.Errorf("usage: wetask enqueue limit|twap|cancel [flags]")
+	}
+	kind := args[0]
+	fs := flag.NewFlagSet("enqueue "+kind, flag.ExitOnError)
+	var (
+		rf                 redisFlags
+		network            = fs.String("network", "", "network name")
+		contract           = fs.String("contract", "", "address of the AutomationCompatible contract")
+		keeper             = fs.String("keeper", "", "address of the keeper")
+		input              = fs.String("input", "", "JSON of the LimitOrderExecuteInput (limit, twap) or the Order (cancel): inline, file or - for stdin")
+		queue              = fs.String("queue", "default", "queue")
+		callback           = fs.String("callback", "", "callback url notified with the result, by a worker with webhookSecretEnv only")
+		processIn          = fs.Duration("process-in", 0, "delay the processing")
+		maxRetry           = fs.Int("max-retry", -1, "max retry, default of the task type when negative")
+		uniqueTTL          = fs.Duration("unique-ttl", 0, "reject the same payload enqueued within the duration")
+		basefeeMultiplier  = fs.Int64("basefee-multiplier", 0, "basefee wiggle multiplier of limit tasks")
+		gasLimitMultiplier = fs.Float64("gaslimit-multiplier", 0, "gas limit multiplier of limit tasks")
+		trigger            = fs.String("trigger", "", "JSON of the price Trigger of a stop-loss or take-profit: inline, file or - for stdin")
+		allowUnknownType   = fs.Bool("allow-unknown-type", false, "enqueue a limit task of an order type missing in the registry")
+		slices             = fs.Int("slices", 0, "slices of the amountIn of a twap task")
+		interval           = fs.Duration("interval", 0, "delay between the slices of a twap task")
+		expiry             = fs.String("expiry", "", "RFC 3339 time the order expires at, the cancel of an execute task is scheduled at it")
+	)
+	rf.register(fs)
+	fs.Parse(args[1:])
+	if *input == "" {
+		return fmt.Errorf("-input is required")
+	}
+	data, err := readInput(*input)
+	if err != nil {
+		return err
+	}
+
+	opts := []asynq.Option{asynq.Queue(*queue)}
+	if *callback != "" {
+		opts = append(opts, limit_keeper.Callback(*callback))
+	}
+	if *processIn > 0 {
+		opts = append(opts, asynq.ProcessIn(*processIn))
+	}
+	if *maxRetry >= 0 {
+		opts = append(opts, asynq.MaxRetry(*maxRetry))
+	}
+	if *expiry != "" {
+		v, err := time.Parse(time.RFC3339, *expiry)
+		if err != nil {
+			return fmt.Errorf("parse expiry: %w", err)
+		}
+		opts = append(opts, limit_keeper.Expiry(v))
+	}
+	var task *asynq.Task
+	switch kind {
+	case "limit", "twap":
+		var in ethorder.LimitOrderExecuteInput
+		if err := cjson.Unmarshal(data, &in); err != nil {
+			return fmt.Errorf("parse input: %w", err)
+		}
+		if *basefeeMultiplier > 0 {
+			opts = append(opts, limit_keeper.BasefeeWiggleMultiplier(big.NewInt(*basefeeMultiplier)))
+		}
+		if *gasLimitMultiplier > 0 {
+			opts = append(opts, limit_keeper.GasLimitMultiplier(*gasLimitMultiplier))
+		}
+		if *trigger != "" {
+			data, err := readInput(*trigger)
+			if err != nil {
+				return err
+			}
+			var tr ethorder.Trigger
+			if err := cjson.Unmarshal(data, &tr); err != nil {
+				return fmt.Errorf("parse trigger: %w", err)
+			}
+			opts = append(opts, limit_keeper.PriceTrigger(tr))
+		}
+		if *allowUnknownType {
+			opts = append(opts, limit_keeper.AllowUnknownOrderType())
+		}
+		if kind == "twap" {
+			task, err = limit_keeper.NewTWAPTask(*network, *contract, *keeper, in, *slices, *interval, opts...)
+		} else {
+			task, err = limit_keeper.NewNormalTask(*network, *contract, *keeper, in, opts...)
+		}
+	case "cancel":
+		var o ethorder.Order
+		if err := cjson.Unmarshal(data, &o); err != nil {
+			return fmt.Errorf("parse input: %w", err)
+		}
+		task, err = limit_keeper.NewCancelTask(*network, *contract, *keeper, o, opts...)
+	}
+	if err != nil {
+		return err
+	}
+
+	client := asynq.NewClient(rf.opt())
+	defer client.Close()
+	// replaces the finished task of the order
+	inspector := asynq.NewInspector(rf.opt())
+	defer inspector.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	info, err := limit_keeper.Enqueue(tasks.WithInspector(ctx, inspector), client, task, *uniqueTTL)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "enqueued %s in %s, state %s\n", info.ID, info.Queue, info.State)
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/hibiken/asynq"
+)
+
+var taskTypes = map[string]bool{
+	tasks.ACT_LIMIT_ORDER:        true,
+	tasks.ACT_CANCEL_LIMIT_ORDER: true,
+	tasks.ACT_TWAP_ORDER:         true,
+}
+
+func runInspect(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	var rf redisFlags
+	rf.register(fs)
+	queue := fs.String("queue", "", "queue, all when empty")
+	states := fs.String("state", "pending,active,scheduled,retry,archived", "comma separated states")
+	size := fs.Int("size", 100, "max tasks listed per queue and state")
+	fs.Parse(args)
+
+	inspector := asynq.NewInspector(rf.opt())
+	defer inspector.Close()
+	queues := []string{*queue}
+	if *queue == "" {
+		var err error
+		if queues, err = inspector.Queues(); err != nil {
+			return err
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATE\tQUEUE\tID\tTYPE\tRETRIED\tNEXT\tLAST ERROR")
+	for _, q := range queues {
+		for _, state := range strings.Split(*states, ",") {
+			list, err := listTasks(inspector, q, strings.TrimSpace(state), *size)
+			if err != nil {
+				return err
+			}
+			for _, info := range list {
+				if !taskTypes[info.Type] {
+					continue
+				}
+				next := ""
+				if !info.NextProcessAt.IsZero() {
+					next = info.NextProcessAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d/%d\t%s\t%s\n",
+					info.State, info.Queue, info.ID, info.Type, info.Retried, info.MaxRetry, next, info.LastErr)
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+func listTasks(inspector *asynq.Inspector, queue, state string, size int) ([]*asynq.TaskInfo, error) {
+	opts := []asynq.ListOption{asynq.PageSize(size)}
+	switch state {
+	case "pending":
+		return inspector.ListPendingTasks(queue, opts...)
+	case "active":
+		return inspector.ListActiveTasks(queue, opts...)
+	case "scheduled":
+		return inspector.ListScheduledTasks(queue, opts...)
+	case "retry":
+		return inspector.ListRetryTasks(queue, opts...)
+	case "archived":
+		return inspector.ListArchivedTasks(queue, opts...)
+	case "completed":
+		return inspector.ListCompletedTasks(queue, opts...)
+	}
+	return nil, fmt.Errorf("unknown state %q", state)
+}
@@ -0,0 +1,137 @@
+// Command wetask enqueues, inspects and decodes the keeper tasks.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hibiken/asynq"
+	"github.com/tinkler/moonmist/pkg/jsonz/cjson"
+)
+
+const usage = `usage: wetask <command> [flags]
+
+commands:
+  enqueue limit|twap|cancel  build a task and enqueue it
+  decode                     print the payload of a task and decode its orderData
+  inspect                    list the keeper tasks in the queues
+  simulate                   run the checkUpkeep of a task against an RPC
+
+run "wetask <command> -h" for the flags of a command
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "enqueue":
+		err = runEnqueue(os.Args[2:], os.Stdout)
+	case "decode":
+		err = runDecode(os.Args[2:], os.Stdout)
+	case "inspect":
+		err = runInspect(os.Args[2:], os.Stdout)
+	case "simulate":
+		err = runSimulate(os.Args[2:], os.Stdout)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "wetask:", err)
+		os.Exit(1)
+	}
+}
+
+type redisFlags struct {
+	addr     string
+	password string
+	db       int
+}
+
+func (f *redisFlags) register(fs *flag.FlagSet) {
+	addr := os.Getenv("WETASK_REDIS")
+	if addr == "" {
+		addr = "127.0.0.1:6379"
+	}
+	fs.StringVar(&f.addr, "redis", addr, "redis address, default $WETASK_REDIS")
+	fs.StringVar(&f.password, "redis-password", os.Getenv("WETASK_REDIS_PASSWORD"), "redis password, default $WETASK_REDIS_PASSWORD")
+	fs.IntVar(&f.db, "redis-db", 0, "redis db")
+}
+
+func (f *redisFlags) opt() asynq.RedisClientOpt {
+	return asynq.RedisClientOpt{Addr: f.addr, Password: f.password, DB: f.db}
+}
+
+// taskFlags select a task in redis by queue and id, or from a payload file
+type taskFlags struct {
+	redisFlags
+	queue    string
+	id       string
+	typename string
+	payload  string
+}
+
+func (f *taskFlags) register(fs *flag.FlagSet) {
+	f.redisFlags.register(fs)
+	fs.StringVar(&f.queue, "queue", "default", "queue of the task")
+	fs.StringVar(&f.id, "id", "", "id of the task in redis")
+	fs.StringVar(&f.typename, "type", "", "type of the task read from -payload")
+	fs.StringVar(&f.payload, "payload", "", "payload file of the task, - for stdin")
+}
+
+func (f *taskFlags) task() (*asynq.Task, error) {
+	if f.id != "" {
+		inspector := asynq.NewInspector(f.opt())
+		defer inspector.Close()
+		info, err := inspector.GetTaskInfo(f.queue, f.id)
+		if err != nil {
+			return nil, err
+		}
+		return asynq.NewTask(info.Type, info.Payload), nil
+	}
+	if f.payload == "" || f.typename == "" {
+		return nil, fmt.Errorf("set -id, or -type and -payload")
+	}
+	data, err := readInput(f.payload)
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewTask(f.typename, data), nil
+}
+
+// readInput reads v as inline JSON, - for stdin, or a file path
+func readInput(v string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(v), "{"):
+		return []byte(v), nil
+	case v == "-":
+		return io.ReadAll(os.Stdin)
+	default:
+		return os.ReadFile(v)
+	}
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	data, err := cjson.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err = out.WriteTo(w)
+	return err
+}
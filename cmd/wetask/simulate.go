@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/WEPublicGoods/wetask/pkg/tasks/order/limit_keeper"
+)
+
+func runSimulate(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	var tf taskFlags
+	tf.register(fs)
+	rpc := fs.String("rpc", "", "rpc url of the network of the task")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout")
+	fs.Parse(args)
+	if *rpc == "" {
+		return fmt.Errorf("-rpc is required")
+	}
+
+	task, err := tf.task()
+	if err != nil {
+		return err
+	}
+	d, err := limit_keeper.DecodeTask(task)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	callable, err := limit_keeper.CheckTask(ctx, eclient.NewEthclientPool(d.NetworkName, *rpc), task)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s %s on %s: callable=%t\n", d.Type, d.AutomationCompatibleAddress.Hex(), d.NetworkName, callable)
+	return nil
+}
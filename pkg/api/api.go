@@ -0,0 +1,303 @@
+package api
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	ethorder "github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/WEPublicGoods/wetask/pkg/tasks/order/limit_keeper"
+	"github.com/hibiken/asynq"
+	"github.com/tinkler/moonmist/pkg/jsonz/cjson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const maxBodyBytes = 1 << 20
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Inspector is satisfied by *asynq.Inspector
+type Inspector interface {
+	GetTaskInfo(queue, id string) (*asynq.TaskInfo, error)
+	DeleteTask(queue, id string) error
+}
+
+type executeRequest struct {
+	NetworkName                 string
+	AutomationCompatibleAddress string
+	Keeper                      string
+	LimitOrder                  ethorder.LimitOrderExecuteInput
+	// required by the order types with RequiresTrigger
+	Trigger     *ethorder.Trigger
+	Queue       string
+	CallbackURL string
+	ProcessAt   *time.Time
+	// the cancel of the order is scheduled at the expiry
+	ExpiresAt *time.Time
+}
+
+type cancelRequest struct {
+	NetworkName                 string
+	AutomationCompatibleAddress string
+	Keeper                      string
+	Order                       ethorder.Order
+	Queue                       string
+	CallbackURL                 string
+	ProcessAt                   *time.Time
+	// processed at the expiry, once a block reached it
+	ExpiresAt *time.Time
+}
+
+type taskResponse struct {
+	ID            string
+	Queue         string
+	Type          string
+	State         string
+	Retried       int
+	MaxRetry      int
+	LastError     string               `json:"lastError,omitempty"`
+	NextProcessAt *time.Time           `json:"nextProcessAt,omitempty"`
+	CompletedAt   *time.Time           `json:"completedAt,omitempty"`
+	Result        *limit_keeper.Result `json:"result,omitempty"`
+}
+
+type errorResponse struct {
+	Error string
+}
+
+type Server struct {
+	enqueuer  tasks.Enqueuer
+	inspector Inspector
+	apiKeys   [][]byte
+	// reject the same payload submitted again within UniqueTTL, disabled when zero
+	UniqueTTL time.Duration
+	// keep the completed tasks and their result for GET /v1/tasks, limit_keeper.DefaultRetention when zero
+	Retention time.Duration
+	// accept the callbackUrl of the requests, only when the worker notifies them
+	Callbacks bool
+}
+
+var errCallbacksDisabled = errors.New("callbackUrl is not supported, the worker has no notifier")
+
+// NewServer serves the API, the requests are authenticated with one of apiKeys
+func NewServer(enqueuer tasks.Enqueuer, inspector Inspector, apiKeys []string) *Server {
+	s := &Server{enqueuer: enqueuer, inspector: inspector}
+	for _, key := range apiKeys {
+		s.apiKeys = append(s.apiKeys, []byte(key))
+	}
+	return s
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPI)
+	})
+	mux.Handle("POST /v1/executions", s.authenticate(http.HandlerFunc(s.execute)))
+	mux.Handle("POST /v1/cancellations", s.authenticate(http.HandlerFunc(s.cancel)))
+	mux.Handle("GET /v1/tasks/{queue}/{id}", s.authenticate(http.HandlerFunc(s.getTask)))
+	mux.Handle("DELETE /v1/tasks/{queue}/{id}", s.authenticate(http.HandlerFunc(s.deleteTask)))
+	return mux
+}
+
+// authenticate accepts "Authorization: Bearer <key>" or "X-API-Key: <key>"
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			key = v
+		}
+		for _, k := range s.apiKeys {
+			if subtle.ConstantTimeCompare(k, []byte(key)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		writeError(w, http.StatusUnauthorized, errors.New("invalid api key"))
+	})
+}
+
+func (s *Server) execute(w http.ResponseWriter, r *http.Request) {
+	var req executeRequest
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	opts, err := s.taskOptions(r, req.CallbackURL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Trigger != nil {
+		opts = append(opts, limit_keeper.PriceTrigger(*req.Trigger))
+	}
+	if req.ExpiresAt != nil {
+		opts = append(opts, limit_keeper.Expiry(*req.ExpiresAt))
+	}
+	task, err := limit_keeper.NewNormalTask(req.NetworkName, req.AutomationCompatibleAddress, req.Keeper, req.LimitOrder, opts...)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.enqueue(w, r, task, req.Queue, req.ProcessAt)
+}
+
+func (s *Server) cancel(w http.ResponseWriter, r *http.Request) {
+	var req cancelRequest
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	opts, err := s.taskOptions(r, req.CallbackURL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.ExpiresAt != nil {
+		opts = append(opts, limit_keeper.Expiry(*req.ExpiresAt))
+	}
+	task, err := limit_keeper.NewCancelTask(req.NetworkName, req.AutomationCompatibleAddress, req.Keeper, req.Order, opts...)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.enqueue(w, r, task, req.Queue, req.ProcessAt)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	return cjson.Json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(v)
+}
+
+// taskOptions continues the trace of the traceparent header unless the payloads are unique by UniqueTTL
+func (s *Server) taskOptions(r *http.Request, callbackURL string) ([]asynq.Option, error) {
+	if callbackURL != "" && !s.Callbacks {
+		return nil, errCallbacksDisabled
+	}
+	var opts []asynq.Option
+	if s.UniqueTTL <= 0 {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		opts = append(opts, limit_keeper.Trace(ctx))
+	}
+	if callbackURL != "" {
+		opts = append(opts, limit_keeper.Callback(callbackURL))
+	}
+	return opts, nil
+}
+
+func (s *Server) enqueue(w http.ResponseWriter, r *http.Request, task *asynq.Task, queue string, processAt *time.Time) {
+	var opts []asynq.Option
+	if queue != "" {
+		opts = append(opts, asynq.Queue(queue))
+	}
+	if processAt != nil {
+		opts = append(opts, asynq.ProcessAt(*processAt))
+	}
+	if s.Retention > 0 {
+		opts = append(opts, asynq.Retention(s.Retention))
+	}
+	// the archived and the completed tasks of the order are replaced
+	ctx := tasks.WithInspector(r.Context(), s.inspector)
+	info, err := limit_keeper.Enqueue(ctx, s.enqueuer, task, s.UniqueTTL, opts...)
+	if err != nil {
+		if errors.Is(err, tasks.ErrDuplicateTask) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, newTaskResponse(info))
+}
+
+// keeperTask returns the task of a keeper, the other tasks of the queue are not found
+func (s *Server) keeperTask(queue, id string) (*asynq.TaskInfo, error) {
+	info, err := s.inspector.GetTaskInfo(queue, id)
+	if err != nil {
+		return nil, err
+	}
+	switch info.Type {
+	case tasks.ACT_LIMIT_ORDER, tasks.ACT_CANCEL_LIMIT_ORDER, tasks.ACT_TWAP_ORDER:
+		return info, nil
+	}
+	return nil, asynq.ErrTaskNotFound
+}
+
+func (s *Server) getTask(w http.ResponseWriter, r *http.Request) {
+	info, err := s.keeperTask(r.PathValue("queue"), r.PathValue("id"))
+	if err != nil {
+		writeInspectError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newTaskResponse(info))
+}
+
+// deleteTask removes a task which is not processing
+func (s *Server) deleteTask(w http.ResponseWriter, r *http.Request) {
+	queue, id := r.PathValue("queue"), r.PathValue("id")
+	info, err := s.keeperTask(queue, id)
+	if err != nil {
+		writeInspectError(w, err)
+		return
+	}
+	if info.State == asynq.TaskStateActive {
+		writeError(w, http.StatusConflict, errors.New("the task is processing"))
+		return
+	}
+	if err := s.inspector.DeleteTask(queue, id); err != nil {
+		writeInspectError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newTaskResponse(info *asynq.TaskInfo) *taskResponse {
+	resp := &taskResponse{
+		ID:        info.ID,
+		Queue:     info.Queue,
+		Type:      info.Type,
+		State:     info.State.String(),
+		Retried:   info.Retried,
+		MaxRetry:  info.MaxRetry,
+		LastError: info.LastErr,
+	}
+	if !info.NextProcessAt.IsZero() {
+		resp.NextProcessAt = &info.NextProcessAt
+	}
+	if !info.CompletedAt.IsZero() {
+		resp.CompletedAt = &info.CompletedAt
+	}
+	if len(info.Result) > 0 {
+		resp.Result, _ = limit_keeper.ParseResult(info.Result)
+	}
+	return resp
+}
+
+func writeInspectError(w http.ResponseWriter, err error) {
+	if errors.Is(err, asynq.ErrTaskNotFound) || errors.Is(err, asynq.ErrQueueNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := cjson.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
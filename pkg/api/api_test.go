@@ -0,0 +1,299 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/WEPublicGoods/wetask/pkg/tasks/order/limit_keeper"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// fakeQueue keeps the tasks like asynq, by queue and id
+type fakeQueue struct {
+	tasks     map[string]*asynq.TaskInfo
+	retention map[string]time.Duration
+	deleted   []string
+}
+
+func newFakeQueue() *fakeQueue {
+	return &fakeQueue{tasks: map[string]*asynq.TaskInfo{}, retention: map[string]time.Duration{}}
+}
+
+// optionsOf are the options given to asynq.NewTask, which asynq keeps unexported
+func optionsOf(task *asynq.Task) []asynq.Option {
+	field := reflect.ValueOf(task).Elem().FieldByName("opts")
+	return *(*[]asynq.Option)(unsafe.Pointer(field.UnsafeAddr()))
+}
+
+func (q *fakeQueue) EnqueueContext(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	info := &asynq.TaskInfo{ID: fmt.Sprintf("%s:%d", task.Type(), len(q.tasks)), Queue: "default", Type: task.Type(), Payload: task.Payload(), State: asynq.TaskStatePending}
+	var retention time.Duration
+	// the options of the enqueue override the ones of the task
+	for _, opt := range append(optionsOf(task), opts...) {
+		switch opt.Type() {
+		case asynq.TaskIDOpt:
+			info.ID = opt.Value().(string)
+		case asynq.QueueOpt:
+			info.Queue = opt.Value().(string)
+		case asynq.RetentionOpt:
+			retention = opt.Value().(time.Duration)
+		case asynq.ProcessAtOpt:
+			info.State, info.NextProcessAt = asynq.TaskStateScheduled, opt.Value().(time.Time)
+		}
+	}
+	if _, ok := q.tasks[info.Queue+"/"+info.ID]; ok {
+		return nil, asynq.ErrTaskIDConflict
+	}
+	q.tasks[info.Queue+"/"+info.ID] = info
+	q.retention[info.Queue+"/"+info.ID] = retention
+	return info, nil
+}
+
+// complete processes the task like the worker, it is dropped without retention
+func (q *fakeQueue) complete(queue, id string, result []byte) {
+	key := queue + "/" + id
+	if q.retention[key] <= 0 {
+		delete(q.tasks, key)
+		return
+	}
+	info := q.tasks[key]
+	info.State, info.Result, info.CompletedAt = asynq.TaskStateCompleted, result, time.Now()
+}
+
+func (q *fakeQueue) GetTaskInfo(queue, id string) (*asynq.TaskInfo, error) {
+	info, ok := q.tasks[queue+"/"+id]
+	if !ok {
+		return nil, asynq.ErrTaskNotFound
+	}
+	return info, nil
+}
+
+func (q *fakeQueue) DeleteTask(queue, id string) error {
+	delete(q.tasks, queue+"/"+id)
+	q.deleted = append(q.deleted, id)
+	return nil
+}
+
+const executeBody = `{
+	"networkName": "sepolia",
+	"automationCompatibleAddress": "0x000000000000000000000000000000000000c0ff",
+	"keeper": "0x0000000000000000000000000000000000001234",
+	"queue": "orders",
+	"callbackUrl": "https://example.com/hook",
+	"limitOrder": {
+		"order": {"account": "0x1111111111111111111111111111111111111111", "index": 1, "orderType": 0, "executeFee": 100},
+		"tokenIn": "0x2222222222222222222222222222222222222222",
+		"tokenOut": "0x3333333333333333333333333333333333333333",
+		"remainingAmountIn": 1000,
+		"amountIn": 1000,
+		"amountOutMin": 900,
+		"amountOutExpected": 950,
+		"routes": [{"dexId": 1, "tokenIn": "0x2222222222222222222222222222222222222222", "tokenOut": "0x3333333333333333333333333333333333333333", "amountIn": 1000, "amountOutMin": 900}]
+	}
+}`
+
+func do(t *testing.T, h http.Handler, method, path, key, body string) (*httptest.ResponseRecorder, map[string]json.RawMessage) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var resp map[string]json.RawMessage
+	if rec.Body.Len() > 0 {
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	}
+	return rec, resp
+}
+
+// newTestServer accepts the callbacks, like a worker with a notifier
+func newTestServer(q *fakeQueue) *Server {
+	srv := NewServer(q, q, []string{"secret"})
+	srv.Callbacks = true
+	return srv
+}
+
+func TestServer(t *testing.T) {
+	q := newFakeQueue()
+	h := newTestServer(q).Handler()
+
+	rec, _ := do(t, h, http.MethodPost, "/v1/executions", "", executeBody)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec, _ = do(t, h, http.MethodPost, "/v1/executions", "wrong", executeBody)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec, resp := do(t, h, http.MethodPost, "/v1/executions", "secret", executeBody)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	var id string
+	assert.NoError(t, json.Unmarshal(resp["id"], &id))
+	limit := order.Order{Account: common.HexToAddress("0x1111111111111111111111111111111111111111"), Index: big.NewInt(1), OrderType: big.NewInt(0), ExecuteFee: big.NewInt(100)}
+	assert.Equal(t, limit_keeper.TaskID("sepolia", common.HexToAddress("0xc0ff"), limit, false), id)
+	assert.JSONEq(t, `"orders"`, string(resp["queue"]))
+	assert.JSONEq(t, `"pending"`, string(resp["state"]))
+	assert.Equal(t, limit_keeper.DefaultRetention, q.retention["orders/"+id])
+
+	// the same order is not executed twice
+	rec, _ = do(t, h, http.MethodPost, "/v1/executions", "secret", executeBody)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// validated by NewNormalTask
+	rec, _ = do(t, h, http.MethodPost, "/v1/executions", "secret", strings.Replace(executeBody, "https://example.com/hook", "ftp://example.com", 1))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec, _ = do(t, h, http.MethodPost, "/v1/executions", "secret", "{")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec, resp = do(t, h, http.MethodPost, "/v1/cancellations", "secret", `{
+		"networkName": "sepolia",
+		"automationCompatibleAddress": "0x000000000000000000000000000000000000c0ff",
+		"keeper": "0x0000000000000000000000000000000000001234",
+		"order": {"account": "0x1111111111111111111111111111111111111111", "index": 1, "orderType": 0, "executeFee": 100}
+	}`)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.JSONEq(t, `"`+tasks.ACT_CANCEL_LIMIT_ORDER+`"`, string(resp["type"]))
+
+	// the result written by the handler, kept once the task is completed
+	result, err := json.Marshal(map[string]interface{}{"outcome": limit_keeper.OutcomeExecuted, "cancel": false})
+	assert.NoError(t, err)
+	q.complete("orders", id, result)
+	rec, resp = do(t, h, http.MethodGet, "/v1/tasks/orders/"+id, "secret", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `"completed"`, string(resp["state"]))
+	var r limit_keeper.Result
+	assert.NoError(t, json.Unmarshal(resp["result"], &r))
+	assert.Equal(t, limit_keeper.OutcomeExecuted, r.Outcome)
+
+	rec, _ = do(t, h, http.MethodGet, "/v1/tasks/default/"+id, "secret", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// the completed task is replaced by a new execution of the order
+	rec, resp = do(t, h, http.MethodPost, "/v1/executions", "secret", executeBody)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.JSONEq(t, `"pending"`, string(resp["state"]))
+	assert.Equal(t, []string{id}, q.deleted)
+	q.deleted = nil
+
+	q.tasks["orders/"+id].State = asynq.TaskStateActive
+	rec, _ = do(t, h, http.MethodDelete, "/v1/tasks/orders/"+id, "secret", "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	q.tasks["orders/"+id].State = asynq.TaskStatePending
+	rec, _ = do(t, h, http.MethodDelete, "/v1/tasks/orders/"+id, "secret", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, []string{id}, q.deleted)
+
+	// the retention of the server
+	q = newFakeQueue()
+	srv := newTestServer(q)
+	srv.Retention = time.Hour
+	rec, _ = do(t, srv.Handler(), http.MethodPost, "/v1/executions", "secret", executeBody)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, time.Hour, q.retention["orders/"+id])
+
+	// without retention the result is lost with the task
+	task, err := limit_keeper.NewCancelTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", limit, asynq.Retention(0))
+	assert.NoError(t, err)
+	info, err := q.EnqueueContext(context.Background(), task)
+	assert.NoError(t, err)
+	q.complete(info.Queue, info.ID, result)
+	rec, _ = do(t, srv.Handler(), http.MethodGet, "/v1/tasks/default/"+info.ID, "secret", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// no callback without a notifier in the worker
+	h = NewServer(newFakeQueue(), q, []string{"secret"}).Handler()
+	rec, _ = do(t, h, http.MethodPost, "/v1/executions", "secret", executeBody)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec, _ = do(t, h, http.MethodPost, "/v1/executions", "secret", strings.Replace(executeBody, `"callbackUrl": "https://example.com/hook",`, "", 1))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+
+	// the document is public
+	rec, resp = do(t, h, http.MethodGet, "/openapi.json", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, resp, "paths")
+}
+
+func TestServer_Expiry(t *testing.T) {
+	q := newFakeQueue()
+	h := newTestServer(q).Handler()
+
+	body := strings.Replace(executeBody, `"queue": "orders",`, `"queue": "orders", "expiresAt": "2030-01-02T03:04:05Z",`, 1)
+	rec, _ := do(t, h, http.MethodPost, "/v1/executions", "secret", body)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	// the cancel is scheduled next to the execution
+	types := map[string]string{}
+	for _, info := range q.tasks {
+		types[info.Type] = info.Queue
+	}
+	assert.Equal(t, map[string]string{tasks.ACT_LIMIT_ORDER: "orders", tasks.ACT_CANCEL_LIMIT_ORDER: "orders"}, types)
+	limit := order.Order{Account: common.HexToAddress("0x1111111111111111111111111111111111111111"), Index: big.NewInt(1)}
+	assert.Contains(t, q.tasks, "orders/"+limit_keeper.ExpiryCancelTaskID("sepolia", common.HexToAddress("0xc0ff"), limit))
+
+	// cancelled before the expiry
+	rec, _ = do(t, h, http.MethodPost, "/v1/cancellations", "secret", `{
+		"networkName": "sepolia",
+		"automationCompatibleAddress": "0x000000000000000000000000000000000000c0ff",
+		"keeper": "0x0000000000000000000000000000000000001234",
+		"queue": "orders",
+		"order": {"account": "0x1111111111111111111111111111111111111111", "index": 1, "orderType": 0, "executeFee": 100}
+	}`)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+
+	rec, _ = do(t, h, http.MethodPost, "/v1/executions", "secret", strings.Replace(executeBody, `"queue": "orders",`, `"expiresAt": "soon",`, 1))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestServer_Trace(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+	post := func(srv *Server) string {
+		req := httptest.NewRequest(http.MethodPost, "/v1/executions", strings.NewReader(executeBody))
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		for _, info := range srv.enqueuer.(*fakeQueue).tasks {
+			return string(info.Payload)
+		}
+		return ""
+	}
+
+	q := newFakeQueue()
+	assert.Contains(t, post(newTestServer(q)), "4bf92f3577b34da6a3ce929d0e0e4736")
+
+	// the same payloads are rejected within UniqueTTL
+	q = newFakeQueue()
+	srv := newTestServer(q)
+	srv.UniqueTTL = time.Minute
+	assert.NotContains(t, post(srv), "traceparent")
+}
+
+func TestServer_OtherTasks(t *testing.T) {
+	q := newFakeQueue()
+	h := newTestServer(q).Handler()
+	info, err := q.EnqueueContext(context.Background(), asynq.NewTask("other", nil), asynq.TaskID("other"))
+	assert.NoError(t, err)
+
+	// the tasks which are not of a keeper are not found
+	rec, _ := do(t, h, http.MethodGet, "/v1/tasks/default/"+info.ID, "secret", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec, _ = do(t, h, http.MethodDelete, "/v1/tasks/default/"+info.ID, "secret", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, q.tasks, "default/other")
+	assert.Empty(t, q.deleted)
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math/big"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
@@ -12,10 +15,16 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/hibiken/asynq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var ErrInvalidRPCs = errors.New("invalid web3 rpcs")
+var (
+	ErrInvalidRPCs         = errors.New("invalid web3 rpcs")
+	ErrTransactionReverted = errors.New("transaction reverted")
+)
 
 type Ethclient interface {
 	ChainID(ctx context.Context) (*big.Int, error)
@@ -23,11 +32,18 @@ type Ethclient interface {
 	GetClient(ctx context.Context) (bind.ContractBackend, error)
 	WaitForReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
 	UrgeReceipt(ctx context.Context, send func() (common.Hash, error), maxIncreaseTimes int) (*types.Receipt, error)
+	ResumeReceipt(ctx context.Context, txHashes []common.Hash) (*types.Receipt, error)
 }
 
 type EthclientPool struct {
 	networkName string
 	rpc         []string
+	observers   []RPCObserver
+	logger      *slog.Logger
+
+	mu sync.Mutex
+	// the observed clients by endpoint, they are kept until Close
+	observed map[string]*ethclient.Client
 }
 
 func NewEthclientPool(networkName string, rpc ...string) *EthclientPool {
@@ -37,16 +53,48 @@ func NewEthclientPool(networkName string, rpc ...string) *EthclientPool {
 	return &EthclientPool{networkName: networkName, rpc: rpc}
 }
 
-func (cli *EthclientPool) getRawClient(ctx context.Context) (*ethclient.Client, error) {
+func (cli *EthclientPool) getRawClient(ctx context.Context) (client *ethclient.Client, err error) {
+	_, span := tracer.Start(ctx, "eclient.dial", trace.WithAttributes(attribute.String("wetask.network", cli.networkName)))
+	defer func() { endSpan(span, err) }()
 	// TODO pool select
-	client, err := ethclient.DialContext(ctx, cli.rpc[0])
+	endpoint := cli.rpc[0]
+	cli.log(ctx, slog.LevelDebug, "dial", slog.String("endpoint", RedactURL(endpoint)))
+	if len(cli.observers) > 0 && (strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://")) {
+		cli.mu.Lock()
+		defer cli.mu.Unlock()
+		if client, ok := cli.observed[endpoint]; ok {
+			return client, nil
+		}
+		c, err := rpc.DialOptions(ctx, endpoint, rpc.WithHTTPClient(cli.httpClient(endpoint)))
+		if err != nil {
+			cli.log(ctx, slog.LevelError, "dial failed", slog.String("endpoint", RedactURL(endpoint)), slog.String("error", RedactURLs(err.Error())))
+			return nil, ErrInvalidRPCs
+		}
+		if cli.observed == nil {
+			cli.observed = make(map[string]*ethclient.Client)
+		}
+		cli.observed[endpoint] = ethclient.NewClient(c)
+		return cli.observed[endpoint], nil
+	}
+	client, err = ethclient.DialContext(ctx, endpoint)
 	if err == nil {
 		return client, err
 	}
+	cli.log(ctx, slog.LevelError, "dial failed", slog.String("endpoint", RedactURL(endpoint)), slog.String("error", RedactURLs(err.Error())))
 
 	return nil, ErrInvalidRPCs
 }
 
+// Close closes the observed clients and their idle connections
+func (cli *EthclientPool) Close() {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	for endpoint, client := range cli.observed {
+		client.Close()
+		delete(cli.observed, endpoint)
+	}
+}
+
 func (cli *EthclientPool) Network() string {
 	return cli.networkName
 }
@@ -68,7 +116,12 @@ func (cli *EthclientPool) ChainID(ctx context.Context) (*big.Int, error) {
 	return c.ChainID(ctx)
 }
 
-func (cli *EthclientPool) WaitForReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+func (cli *EthclientPool) WaitForReceipt(ctx context.Context, txHash common.Hash) (receipt *types.Receipt, err error) {
+	ctx, span := tracer.Start(ctx, "eclient.WaitForReceipt", trace.WithAttributes(
+		attribute.String("wetask.network", cli.networkName),
+		attribute.String("wetask.tx_hash", txHash.Hex()),
+	))
+	defer func() { endSpan(span, err) }()
 	c, err := cli.getRawClient(ctx)
 	if err != nil {
 		return nil, err
@@ -87,15 +140,19 @@ func (cli *EthclientPool) WaitForReceipt(ctx context.Context, txHash common.Hash
 			return nil, err
 		}
 		if receipt != nil && receipt.Status == types.ReceiptStatusFailed {
-			return nil, fmt.Errorf("transaction %s failed, %w", txHash.Hex(), asynq.SkipRetry)
+			cli.log(ctx, slog.LevelWarn, "transaction reverted", slog.String("tx", txHash.Hex()), slog.Uint64("block", receipt.BlockNumber.Uint64()))
+			return receipt, fmt.Errorf("transaction %s failed, %w, %w", txHash.Hex(), ErrTransactionReverted, asynq.SkipRetry)
 		}
 		if receipt != nil && receipt.BlockNumber.Cmp(big.NewInt(0)) > 0 {
+			cli.log(ctx, slog.LevelDebug, "transaction included", slog.String("tx", txHash.Hex()), slog.Uint64("block", receipt.BlockNumber.Uint64()), slog.Uint64("gasUsed", receipt.GasUsed))
 			return receipt, nil
 		}
 	}
 }
 
-func (cli *EthclientPool) UrgeReceipt(ctx context.Context, send func() (common.Hash, error), maxIncreaseTimes int) (*types.Receipt, error) {
+func (cli *EthclientPool) UrgeReceipt(ctx context.Context, send func() (common.Hash, error), maxIncreaseTimes int) (receipt *types.Receipt, err error) {
+	ctx, span := tracer.Start(ctx, "eclient.UrgeReceipt", trace.WithAttributes(attribute.String("wetask.network", cli.networkName)))
+	defer func() { endSpan(span, err) }()
 	c, err := cli.getRawClient(ctx)
 	if err != nil {
 		return nil, err
@@ -105,12 +162,14 @@ func (cli *EthclientPool) UrgeReceipt(ctx context.Context, send func() (common.H
 		if err != nil {
 			return nil, err
 		}
+		span.SetAttributes(attribute.String("wetask.tx_hash", txHash.Hex()))
 		receipt, err := c.TransactionReceipt(ctx, txHash)
 		if err != nil {
 			if err == ethereum.NotFound {
 				if ctx.Err() == nil {
 					time.Sleep(1 * time.Second)
 					if maxIncreaseTimes == 0 {
+						cli.log(ctx, slog.LevelWarn, "transaction not included after the fee bumps", slog.String("tx", txHash.Hex()))
 						return nil, fmt.Errorf("failed after %d times to increase gas, %w", maxIncreaseTimes, asynq.SkipRetry)
 					}
 					maxIncreaseTimes--
@@ -122,10 +181,51 @@ func (cli *EthclientPool) UrgeReceipt(ctx context.Context, send func() (common.H
 			return nil, err
 		}
 		if receipt != nil && receipt.Status == types.ReceiptStatusFailed {
-			return nil, fmt.Errorf("transaction %s failed, %w", txHash.Hex(), asynq.SkipRetry)
+			cli.log(ctx, slog.LevelWarn, "transaction reverted", slog.String("tx", txHash.Hex()), slog.Uint64("block", receipt.BlockNumber.Uint64()))
+			return receipt, fmt.Errorf("transaction %s failed, %w, %w", txHash.Hex(), ErrTransactionReverted, asynq.SkipRetry)
 		}
 		if receipt != nil && receipt.BlockNumber.Cmp(big.NewInt(0)) > 0 {
+			cli.log(ctx, slog.LevelDebug, "transaction included", slog.String("tx", txHash.Hex()), slog.Uint64("block", receipt.BlockNumber.Uint64()), slog.Uint64("gasUsed", receipt.GasUsed))
 			return receipt, nil
 		}
 	}
 }
+
+// ResumeReceipt waits for the receipt of any of txHashes, ethereum.NotFound when none is known anymore
+func (cli *EthclientPool) ResumeReceipt(ctx context.Context, txHashes []common.Hash) (receipt *types.Receipt, err error) {
+	ctx, span := tracer.Start(ctx, "eclient.ResumeReceipt", trace.WithAttributes(attribute.Int("wetask.tx_count", len(txHashes))))
+	defer func() { endSpan(span, err) }()
+	c, err := cli.getRawClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		known := false
+		for _, txHash := range txHashes {
+			receipt, err := c.TransactionReceipt(ctx, txHash)
+			if err == nil {
+				if receipt.Status == types.ReceiptStatusFailed {
+					return receipt, fmt.Errorf("transaction %s failed, %w, %w", txHash.Hex(), ErrTransactionReverted, asynq.SkipRetry)
+				}
+				return receipt, nil
+			}
+			if err != ethereum.NotFound {
+				return nil, err
+			}
+			_, _, err = c.TransactionByHash(ctx, txHash)
+			if err == nil {
+				known = true
+			} else if err != ethereum.NotFound {
+				return nil, err
+			}
+		}
+		if !known {
+			return nil, ethereum.NotFound
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package eclient
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+)
+
+// WithLogger logs the dials and the receipts of the pool with logger, nothing is logged by default
+func (cli *EthclientPool) WithLogger(logger *slog.Logger) *EthclientPool {
+	cli.logger = logger
+	return cli
+}
+
+func (cli *EthclientPool) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if cli.logger == nil {
+		return
+	}
+	cli.logger.Log(ctx, level, msg, append([]any{slog.String("network", cli.networkName)}, args...)...)
+}
+
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?|wss?)://[^\s"'<>]+`)
+
+// RedactURLs redacts with RedactURL the URLs found in s, such as in the errors of the RPC client
+func RedactURLs(s string) string {
+	return urlPattern.ReplaceAllStringFunc(s, RedactURL)
+}
+
+// RedactAttr is a slog.HandlerOptions.ReplaceAttr redacting the URLs in the string and error values
+func RedactAttr(groups []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(RedactURLs(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(RedactURLs(err.Error()))
+		}
+	}
+	return a
+}
@@ -0,0 +1,135 @@
+package eclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RPCCall is a JSON-RPC request sent over HTTP by the pool, a batch has the Method "batch"
+type RPCCall struct {
+	NetworkName string
+	Endpoint    string
+	Method      string
+	Start       time.Time
+	Duration    time.Duration
+	// the transport error, the failed HTTP status or the error of the JSON-RPC response
+	Err error
+}
+
+// RPCObserver is called after every RPCCall with the context of the request
+type RPCObserver func(ctx context.Context, call *RPCCall)
+
+// Use observes the JSON-RPC requests to the HTTP endpoints of the pool
+func (cli *EthclientPool) Use(observers ...RPCObserver) *EthclientPool {
+	cli.observers = append(cli.observers, observers...)
+	return cli
+}
+
+// RedactURL keeps the scheme and the host of an RPC URL, dropping its API keys
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "invalid"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func (cli *EthclientPool) httpClient(endpoint string) *http.Client {
+	return &http.Client{Transport: &observedTransport{
+		next:        http.DefaultTransport,
+		networkName: cli.networkName,
+		endpoint:    RedactURL(endpoint),
+		observers:   cli.observers,
+	}}
+}
+
+type observedTransport struct {
+	next        http.RoundTripper
+	networkName string
+	endpoint    string
+	observers   []RPCObserver
+}
+
+type rpcMessage struct {
+	Method string          `json:"method"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// CloseIdleConnections is called by the http.Client closed with its RPC client
+func (t *observedTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+func (t *observedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := "unknown"
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		method = rpcMethod(body)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	observed := err
+	if err == nil {
+		observed = rpcError(resp)
+	}
+	call := &RPCCall{
+		NetworkName: t.networkName,
+		Endpoint:    t.endpoint,
+		Method:      method,
+		Start:       start,
+		Duration:    time.Since(start),
+		Err:         observed,
+	}
+	for _, observe := range t.observers {
+		observe(req.Context(), call)
+	}
+	return resp, err
+}
+
+func rpcMethod(body []byte) string {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		return "batch"
+	}
+	var msg rpcMessage
+	if json.Unmarshal(body, &msg) != nil || msg.Method == "" {
+		return "unknown"
+	}
+	return msg.Method
+}
+
+// rpcError reports a failed HTTP status or the error of a single JSON-RPC response
+func rpcError(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("http status %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(string(bytes.TrimSpace(body)), "{") {
+		return nil
+	}
+	var msg rpcMessage
+	if json.Unmarshal(body, &msg) == nil && len(msg.Error) > 0 && string(msg.Error) != "null" {
+		return errors.New("rpc error " + string(msg.Error))
+	}
+	return nil
+}
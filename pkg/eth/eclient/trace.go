@@ -0,0 +1,34 @@
+package eclient
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/WEPublicGoods/wetask/pkg/eth/eclient")
+
+// TraceRPC is an RPCObserver recording a client span per call under the span of ctx
+func TraceRPC(ctx context.Context, call *RPCCall) {
+	_, span := tracer.Start(ctx, "rpc "+call.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(call.Start),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "jsonrpc"),
+			attribute.String("rpc.method", call.Method),
+			attribute.String("server.address", call.Endpoint),
+			attribute.String("wetask.network", call.NetworkName),
+		))
+	endSpan(span, call.Err, trace.WithTimestamp(call.Start.Add(call.Duration)))
+}
+
+func endSpan(span trace.Span, err error, opts ...trace.SpanEndOption) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(opts...)
+}
@@ -0,0 +1,38 @@
+package eclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceRPC(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	// the global tracer provider delegates to the first provider set only
+	prev := tracer
+	tracer = tp.Tracer("github.com/WEPublicGoods/wetask/pkg/eth/eclient")
+	t.Cleanup(func() { tracer = prev })
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "task")
+
+	start := time.Now().Add(-time.Second)
+	TraceRPC(ctx, &RPCCall{NetworkName: "sepolia", Endpoint: "https://rpc.example.com", Method: "eth_call", Start: start, Duration: 200 * time.Millisecond, Err: errors.New("limit exceeded")})
+	parent.End()
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	span := spans[0]
+	assert.Equal(t, "rpc eth_call", span.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	assert.Equal(t, start.UnixNano(), span.StartTime().UnixNano())
+	assert.Equal(t, 200*time.Millisecond, span.EndTime().Sub(span.StartTime()))
+	assert.Contains(t, span.Attributes(), attribute.String("server.address", "https://rpc.example.com"))
+	assert.Equal(t, codes.Error, span.Status().Code)
+}
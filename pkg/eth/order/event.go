@@ -0,0 +1,129 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// OrderExecutedEventABI is the event decoded by DefaultFillDecoder
+const OrderExecutedEventABI = `[{"anonymous":false,"inputs":[` +
+	`{"indexed":true,"internalType":"address","name":"account","type":"address"},` +
+	`{"indexed":true,"internalType":"uint256","name":"index","type":"uint256"},` +
+	`{"indexed":false,"internalType":"uint256","name":"amountIn","type":"uint256"},` +
+	`{"indexed":false,"internalType":"uint256","name":"amountOut","type":"uint256"}` +
+	`],"name":"OrderExecuted","type":"event"}]`
+
+var ErrFillNotFound = errors.New("fill event not found")
+
+// Fill is the execution outcome of an order read from the receipt.
+type Fill struct {
+	Account   common.Address
+	Index     *big.Int
+	AmountIn  *big.Int
+	AmountOut *big.Int
+	// RemainingAmountIn after the fill
+	RemainingAmountIn *big.Int
+	Partial           bool
+	TxHash            common.Hash
+	LogIndex          uint
+}
+
+// FillDecoder decodes the fills of an event carrying the account, index, amountIn and amountOut arguments.
+type FillDecoder struct {
+	event abi.Event
+}
+
+var defaultFillDecoder *FillDecoder
+
+func init() {
+	var err error
+	defaultFillDecoder, err = NewFillDecoder(OrderExecutedEventABI, "OrderExecuted")
+	if err != nil {
+		panic(err)
+	}
+}
+
+func DefaultFillDecoder() *FillDecoder {
+	return defaultFillDecoder
+}
+
+// NewFillDecoder decodes the event eventName of the JSON ABI eventABI
+func NewFillDecoder(eventABI string, eventName string) (*FillDecoder, error) {
+	parsed, err := abi.JSON(strings.NewReader(eventABI))
+	if err != nil {
+		return nil, err
+	}
+	event, ok := parsed.Events[eventName]
+	if !ok {
+		return nil, fmt.Errorf("event %s is not in the abi", eventName)
+	}
+	for _, name := range []string{"account", "index", "amountIn", "amountOut"} {
+		found := false
+		for _, input := range event.Inputs {
+			found = found || input.Name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("event %s has no %s argument", eventName, name)
+		}
+	}
+	return &FillDecoder{event: event}, nil
+}
+
+// Decode returns the fill of order in the logs of contract in receipt
+func (d *FillDecoder) Decode(receipt *types.Receipt, contract common.Address, order Order, remainingAmountIn *big.Int) (*Fill, error) {
+	var indexed abi.Arguments
+	for _, input := range d.event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	for _, log := range receipt.Logs {
+		// any contract can emit the event
+		if log.Address != contract || len(log.Topics) == 0 || log.Topics[0] != d.event.ID {
+			continue
+		}
+		values := make(map[string]interface{})
+		if err := d.event.Inputs.UnpackIntoMap(values, log.Data); err != nil {
+			return nil, err
+		}
+		if err := abi.ParseTopicsIntoMap(values, indexed, log.Topics[1:]); err != nil {
+			return nil, err
+		}
+		account, _ := values["account"].(common.Address)
+		index, _ := values["index"].(*big.Int)
+		if account != order.Account || index == nil || order.Index == nil || index.Cmp(order.Index) != 0 {
+			continue
+		}
+		amountIn, ok := values["amountIn"].(*big.Int)
+		if !ok {
+			return nil, fmt.Errorf("amountIn of event %s is not an uint", d.event.Name)
+		}
+		amountOut, ok := values["amountOut"].(*big.Int)
+		if !ok {
+			return nil, fmt.Errorf("amountOut of event %s is not an uint", d.event.Name)
+		}
+		fill := &Fill{
+			Account:   account,
+			Index:     index,
+			AmountIn:  amountIn,
+			AmountOut: amountOut,
+			TxHash:    log.TxHash,
+			LogIndex:  log.Index,
+		}
+		if remainingAmountIn != nil {
+			fill.RemainingAmountIn = new(big.Int).Sub(remainingAmountIn, fill.AmountIn)
+			if fill.RemainingAmountIn.Sign() < 0 {
+				fill.RemainingAmountIn.SetInt64(0)
+			}
+			fill.Partial = fill.RemainingAmountIn.Sign() > 0
+		}
+		return fill, nil
+	}
+	return nil, ErrFillNotFound
+}
@@ -0,0 +1,76 @@
+package order
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+var contract = common.HexToAddress("0x000000000000000000000000000000000000c0ff")
+
+func orderExecutedLog(account common.Address, index, amountIn, amountOut int64) *types.Log {
+	data := append(common.LeftPadBytes(big.NewInt(amountIn).Bytes(), 32), common.LeftPadBytes(big.NewInt(amountOut).Bytes(), 32)...)
+	return &types.Log{
+		Address: contract,
+		Topics: []common.Hash{
+			crypto.Keccak256Hash([]byte("OrderExecuted(address,uint256,uint256,uint256)")),
+			common.BytesToHash(account.Bytes()),
+			common.BigToHash(big.NewInt(index)),
+		},
+		Data: data,
+	}
+}
+
+func TestFillDecoder_Decode(t *testing.T) {
+	account := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	order := Order{Account: account, Index: big.NewInt(1), OrderType: big.NewInt(0), ExecuteFee: big.NewInt(0)}
+	receipt := &types.Receipt{Logs: []*types.Log{
+		{Topics: []common.Hash{crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))}},
+		orderExecutedLog(account, 2, 10, 20),
+		orderExecutedLog(account, 1, 600, 1200),
+	}}
+
+	t.Run("partial", func(t *testing.T) {
+		fill, err := DefaultFillDecoder().Decode(receipt, contract, order, big.NewInt(1000))
+		assert.NoError(t, err)
+		assert.Equal(t, account, fill.Account)
+		assert.Equal(t, big.NewInt(1), fill.Index)
+		assert.Equal(t, big.NewInt(600), fill.AmountIn)
+		assert.Equal(t, big.NewInt(1200), fill.AmountOut)
+		assert.Equal(t, big.NewInt(400), fill.RemainingAmountIn)
+		assert.True(t, fill.Partial)
+	})
+
+	t.Run("full", func(t *testing.T) {
+		fill, err := DefaultFillDecoder().Decode(receipt, contract, order, big.NewInt(600))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, fill.RemainingAmountIn.Sign())
+		assert.False(t, fill.Partial)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		other := order
+		other.Index = big.NewInt(3)
+		_, err := DefaultFillDecoder().Decode(receipt, contract, other, big.NewInt(600))
+		assert.ErrorIs(t, err, ErrFillNotFound)
+	})
+
+	t.Run("other contract", func(t *testing.T) {
+		spoofed := orderExecutedLog(account, 1, 1, 1)
+		spoofed.Address = common.HexToAddress("0xbad")
+		_, err := DefaultFillDecoder().Decode(&types.Receipt{Logs: []*types.Log{spoofed}}, contract, order, big.NewInt(600))
+		assert.ErrorIs(t, err, ErrFillNotFound)
+	})
+}
+
+func TestNewFillDecoder(t *testing.T) {
+	_, err := NewFillDecoder(OrderExecutedEventABI, "OrderFilled")
+	assert.Error(t, err)
+
+	_, err = NewFillDecoder(`[{"anonymous":false,"inputs":[{"indexed":true,"name":"account","type":"address"}],"name":"OrderExecuted","type":"event"}]`, "OrderExecuted")
+	assert.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package order
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
@@ -90,3 +91,60 @@ type LimitOrderExecuteInput struct {
 	AmountOutExpected *big.Int
 	FeeReceiver       common.Address
 }
+
+// Pack encodes in as the orderData of checkUpkeep and performUpkeep
+func (in *LimitOrderExecuteInput) Pack(isExpired bool) ([]byte, error) {
+	routes := in.Routes
+	if routes == nil {
+		routes = []SwapRoute{}
+	}
+	return LimitOrderExecuteInputABI.Pack(
+		in.Order,
+		isExpired,
+		in.TokenIn,
+		in.TokenOut,
+		in.RemainingAmountIn,
+		routes,
+		in.AmountIn,
+		in.AmountOutMin,
+		in.AmountOutExpected,
+		in.FeeReceiver,
+	)
+}
+
+// DecodeLimitOrderExecuteInput decodes an orderData encoded by LimitOrderExecuteInput.Pack
+func DecodeLimitOrderExecuteInput(data []byte) (in *LimitOrderExecuteInput, isExpired bool, err error) {
+	values, err := LimitOrderExecuteInputABI.Unpack(data)
+	if err != nil {
+		return nil, false, err
+	}
+	in = new(LimitOrderExecuteInput)
+	for i, dst := range []interface{}{
+		&in.Order,
+		&isExpired,
+		&in.TokenIn,
+		&in.TokenOut,
+		&in.RemainingAmountIn,
+		&in.Routes,
+		&in.AmountIn,
+		&in.AmountOutMin,
+		&in.AmountOutExpected,
+		&in.FeeReceiver,
+	} {
+		if err := convertArgument(values[i], dst); err != nil {
+			return nil, false, fmt.Errorf("argument %d: %w", i, err)
+		}
+	}
+	return in, isExpired, nil
+}
+
+// convertArgument sets dst to the unpacked value, the tuples are unpacked to anonymous structs
+func convertArgument(value interface{}, dst interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unexpected type %T", value)
+		}
+	}()
+	abi.ConvertType(value, dst)
+	return nil
+}
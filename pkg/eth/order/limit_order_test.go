@@ -1,6 +1,7 @@
 package order
 
 import (
+	"encoding/json"
 	"math/big"
 	"testing"
 
@@ -9,45 +10,99 @@ import (
 )
 
 func TestLimitOrderExecuteInput_PackUnpack(t *testing.T) {
-	// Create test data
 	order := Order{
 		Account:    common.HexToAddress("0x1111111111111111111111111111111111111111"),
 		Index:      big.NewInt(1),
 		OrderType:  big.NewInt(2),
 		ExecuteFee: big.NewInt(100),
 	}
+	tokenIn := common.HexToAddress("0x4444444444444444444444444444444444444444")
+	middle := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	tokenOut := common.HexToAddress("0x5555555555555555555555555555555555555555")
 
-	routes := []SwapRoute{
-		{
-			DexId:        1,
-			TokenIn:      common.HexToAddress("0x2222222222222222222222222222222222222222"),
-			TokenOut:     common.HexToAddress("0x3333333333333333333333333333333333333333"),
-			AmountIn:     big.NewInt(1000),
-			AmountOutMin: big.NewInt(900),
-			ExtraData:    []byte{0x01, 0x02},
+	for name, tc := range map[string]struct {
+		input     LimitOrderExecuteInput
+		isExpired bool
+	}{
+		"single route": {
+			input: LimitOrderExecuteInput{
+				Order:             order,
+				TokenIn:           tokenIn,
+				TokenOut:          tokenOut,
+				RemainingAmountIn: big.NewInt(20000),
+				Routes: []SwapRoute{
+					{DexId: 1, TokenIn: tokenIn, TokenOut: tokenOut, AmountIn: big.NewInt(10000), AmountOutMin: big.NewInt(9500), ExtraData: []byte{0x01, 0x02}},
+				},
+				AmountIn:          big.NewInt(10000),
+				AmountOutMin:      big.NewInt(9500),
+				AmountOutExpected: big.NewInt(10000),
+				FeeReceiver:       common.HexToAddress("0x6666666666666666666666666666666666666666"),
+			},
 		},
+		"multi hop": {
+			input: LimitOrderExecuteInput{
+				Order:             order,
+				TokenIn:           tokenIn,
+				TokenOut:          tokenOut,
+				RemainingAmountIn: big.NewInt(10000),
+				Routes: []SwapRoute{
+					{DexId: 1, TokenIn: tokenIn, TokenOut: middle, AmountIn: big.NewInt(10000), AmountOutMin: big.NewInt(0), ExtraData: []byte{}},
+					{DexId: 65535, TokenIn: middle, TokenOut: tokenOut, AmountIn: big.NewInt(0), AmountOutMin: big.NewInt(9000), ExtraData: common.FromHex("0x000bb8")},
+				},
+				AmountIn:          big.NewInt(10000),
+				AmountOutMin:      big.NewInt(9000),
+				AmountOutExpected: new(big.Int).Lsh(big.NewInt(1), 255),
+				FeeReceiver:       common.HexToAddress("0x6666666666666666666666666666666666666666"),
+			},
+		},
+		"cancel": {
+			input: LimitOrderExecuteInput{
+				Order:             order,
+				RemainingAmountIn: big.NewInt(0),
+				Routes:            []SwapRoute{},
+				AmountIn:          big.NewInt(0),
+				AmountOutMin:      big.NewInt(0),
+				AmountOutExpected: big.NewInt(0),
+				FeeReceiver:       common.HexToAddress("0x7777777777777777777777777777777777777777"),
+			},
+			isExpired: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			packed, err := tc.input.Pack(tc.isExpired)
+			assert.NoError(t, err)
+
+			decoded, isExpired, err := DecodeLimitOrderExecuteInput(packed)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.isExpired, isExpired)
+			// big.Int zeros differ internally, compare the values
+			assert.JSONEq(t, mustJSON(t, tc.input), mustJSON(t, decoded))
+		})
 	}
+}
 
-	// Pack the input
-	packed, err := LimitOrderExecuteInputABI.Pack(
-		order,
-		false,
-		common.HexToAddress("0x4444444444444444444444444444444444444444"),
-		common.HexToAddress("0x5555555555555555555555555555555555555555"),
-		big.NewInt(1),
-		routes,
-		big.NewInt(10000),
-		big.NewInt(9500),
-		big.NewInt(10000),
-		common.HexToAddress("0x6666666666666666666666666666666666666666"),
-	)
+func TestLimitOrderExecuteInput_PackNilRoutes(t *testing.T) {
+	input := LimitOrderExecuteInput{
+		Order:             Order{Index: big.NewInt(1), OrderType: big.NewInt(0), ExecuteFee: big.NewInt(0)},
+		RemainingAmountIn: big.NewInt(0),
+		AmountIn:          big.NewInt(0),
+		AmountOutMin:      big.NewInt(0),
+		AmountOutExpected: big.NewInt(0),
+	}
+	packed, err := input.Pack(true)
 	assert.NoError(t, err)
-	assert.NotEmpty(t, packed)
-
-	// Unpack the packed data
-	unpacked, err := LimitOrderExecuteInputABI.Unpack(packed)
+	decoded, _, err := DecodeLimitOrderExecuteInput(packed)
 	assert.NoError(t, err)
+	assert.Empty(t, decoded.Routes)
+}
 
-	t.Logf("%v", unpacked)
+func TestDecodeLimitOrderExecuteInput_Invalid(t *testing.T) {
+	_, _, err := DecodeLimitOrderExecuteInput([]byte{0x01, 0x02})
+	assert.Error(t, err)
+}
 
+func mustJSON(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	return string(data)
 }
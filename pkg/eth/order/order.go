@@ -1,10 +1,12 @@
 package order
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 var OrderABI abi.Arguments
@@ -32,3 +34,32 @@ type Order struct {
 	OrderType  *big.Int
 	ExecuteFee *big.Int
 }
+
+// Key identifies the order by its account and index, as "<checksummed account>:<index>"
+func (o Order) Key() string {
+	index := o.Index
+	if index == nil {
+		index = new(big.Int)
+	}
+	return fmt.Sprintf("%s:%s", o.Account.Hex(), index)
+}
+
+// Hash is the keccak256 of the order encoded with OrderABI, the nil numbers are encoded as 0
+func (o Order) Hash() (common.Hash, error) {
+	for _, v := range []struct {
+		field string
+		value **big.Int
+	}{{"index", &o.Index}, {"orderType", &o.OrderType}, {"executeFee", &o.ExecuteFee}} {
+		if *v.value == nil {
+			*v.value = new(big.Int)
+		}
+		if (*v.value).Sign() < 0 || (*v.value).BitLen() > 256 {
+			return common.Hash{}, fmt.Errorf("%w: order %s %s", ErrInvalidAmount, v.field, *v.value)
+		}
+	}
+	data, err := OrderABI.Pack(o)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(data), nil
+}
@@ -0,0 +1,75 @@
+package order
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrder_Key(t *testing.T) {
+	o := Order{
+		Account:    common.HexToAddress("0xabcdefabcdefabcdefabcdefabcdefabcdefabcd"),
+		Index:      big.NewInt(42),
+		OrderType:  big.NewInt(1),
+		ExecuteFee: big.NewInt(100),
+	}
+	assert.Equal(t, "0xABcdEFABcdEFabcdEfAbCdefabcdeFABcDEFabCD:42", o.Key())
+
+	// the fee and the type don't identify the order
+	same := o
+	same.OrderType, same.ExecuteFee = big.NewInt(2), big.NewInt(200)
+	assert.Equal(t, o.Key(), same.Key())
+	other := o
+	other.Index = big.NewInt(43)
+	assert.NotEqual(t, o.Key(), other.Key())
+
+	assert.Equal(t, "0xABcdEFABcdEFabcdEfAbCdefabcdeFABcDEFabCD:0", Order{Account: o.Account}.Key())
+}
+
+func TestOrder_Hash(t *testing.T) {
+	for _, tc := range []struct {
+		order Order
+		want  string
+	}{
+		{
+			Order{Account: common.HexToAddress("0x1111111111111111111111111111111111111111"), Index: big.NewInt(1), OrderType: big.NewInt(2), ExecuteFee: big.NewInt(100)},
+			"0xcd6659dbb24b088a64b764b2886e0132a64a9392d4dc02f9ee2f65ec5cf878fd",
+		},
+		// nil numbers are 0
+		{Order{}, "0x012893657d8eb2efad4de0a91bcd0e39ad9837745dec3ea923737ea803fc8e3d"},
+	} {
+		hash, err := tc.order.Hash()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.want, hash.Hex())
+	}
+
+	// the static tuple is the 4 words of its fields
+	o := Order{Account: common.HexToAddress("0x1111111111111111111111111111111111111111"), Index: big.NewInt(1), OrderType: big.NewInt(2), ExecuteFee: big.NewInt(100)}
+	var encoded []byte
+	encoded = append(encoded, common.LeftPadBytes(o.Account.Bytes(), 32)...)
+	for _, v := range []*big.Int{o.Index, o.OrderType, o.ExecuteFee} {
+		encoded = append(encoded, common.LeftPadBytes(v.Bytes(), 32)...)
+	}
+	hash, _ := o.Hash()
+	assert.Equal(t, crypto.Keccak256Hash(encoded), hash)
+	hash, _ = Order{}.Hash()
+	assert.Equal(t, crypto.Keccak256Hash(make([]byte, 128)), hash)
+
+	fee := o
+	fee.ExecuteFee = big.NewInt(101)
+	feeHash, _ := fee.Hash()
+	assert.NotEqual(t, hash, feeHash)
+
+	// not wrapped around
+	negative := o
+	negative.Index = big.NewInt(-1)
+	_, err := negative.Hash()
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	overflow := o
+	overflow.ExecuteFee = new(big.Int).Lsh(big.NewInt(1), 256)
+	_, err = overflow.Hash()
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+}
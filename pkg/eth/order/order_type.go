@@ -0,0 +1,107 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+var ErrUnknownOrderType = errors.New("unknown order type")
+
+// OrderTypeSpec holds the rules of an order type
+type OrderTypeSpec struct {
+	ID   uint64
+	Name string
+	// the executions swap through Routes, otherwise the contract fills the order without them
+	RequiresRoutes bool
+	// an expired order is not executed anymore, only cancelled
+	CancelOnlyWhenExpired bool
+	// the execution waits for a price Trigger
+	RequiresTrigger bool
+	// Validate checks the inputs of the type after LimitOrderExecuteInput.Validate, optional
+	Validate func(in *LimitOrderExecuteInput) error
+	// Build completes the input before it is packed by the keeper, optional
+	Build func(in *LimitOrderExecuteInput) error
+}
+
+var orderTypes = struct {
+	sync.RWMutex
+	byID   map[uint64]*OrderTypeSpec
+	byName map[string]*OrderTypeSpec
+}{
+	byID:   make(map[uint64]*OrderTypeSpec),
+	byName: make(map[string]*OrderTypeSpec),
+}
+
+// RegisterOrderType adds spec to the known order types, its id and name must be new
+func RegisterOrderType(spec OrderTypeSpec) error {
+	if spec.Name == "" {
+		return errors.New("order type name is required")
+	}
+	orderTypes.Lock()
+	defer orderTypes.Unlock()
+	if _, ok := orderTypes.byID[spec.ID]; ok {
+		return fmt.Errorf("order type %d is already registered", spec.ID)
+	}
+	if _, ok := orderTypes.byName[spec.Name]; ok {
+		return fmt.Errorf("order type %s is already registered", spec.Name)
+	}
+	orderTypes.byID[spec.ID] = &spec
+	orderTypes.byName[spec.Name] = &spec
+	return nil
+}
+
+// LookupOrderType returns the spec of orderType, false when it is not registered
+func LookupOrderType(orderType *big.Int) (*OrderTypeSpec, bool) {
+	if orderType == nil || !orderType.IsUint64() {
+		return nil, false
+	}
+	orderTypes.RLock()
+	defer orderTypes.RUnlock()
+	spec, ok := orderTypes.byID[orderType.Uint64()]
+	return spec, ok
+}
+
+// OrderTypeByName returns the spec registered as name
+func OrderTypeByName(name string) (*OrderTypeSpec, bool) {
+	orderTypes.RLock()
+	defer orderTypes.RUnlock()
+	spec, ok := orderTypes.byName[name]
+	return spec, ok
+}
+
+// TypeName is the name of the order type, or its number when it is not registered
+func (o Order) TypeName() string {
+	if spec, ok := LookupOrderType(o.OrderType); ok {
+		return spec.Name
+	}
+	return fmt.Sprintf("%v", o.OrderType)
+}
+
+// ValidateType checks in with the rules of its order type, every type is accepted until some are registered
+func (in *LimitOrderExecuteInput) ValidateType() error {
+	spec, ok := LookupOrderType(in.Order.OrderType)
+	if !ok {
+		orderTypes.RLock()
+		registered := len(orderTypes.byID) > 0
+		orderTypes.RUnlock()
+		if !registered {
+			return nil
+		}
+		return &ValidationError{Field: "order.orderType", Err: ErrUnknownOrderType, Detail: fmt.Sprintf("%v", in.Order.OrderType)}
+	}
+	if spec.Validate != nil {
+		return spec.Validate(in)
+	}
+	return nil
+}
+
+// Build completes in with the builder of its order type, if any
+func (in *LimitOrderExecuteInput) Build() error {
+	spec, ok := LookupOrderType(in.Order.OrderType)
+	if !ok || spec.Build == nil {
+		return nil
+	}
+	return spec.Build(in)
+}
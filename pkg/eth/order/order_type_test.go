@@ -0,0 +1,83 @@
+package order
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// unregisterOrderType forgets the order type id, registered again by the next run of the tests
+func unregisterOrderType(id uint64) {
+	orderTypes.Lock()
+	defer orderTypes.Unlock()
+	if spec, ok := orderTypes.byID[id]; ok {
+		delete(orderTypes.byName, spec.Name)
+		delete(orderTypes.byID, id)
+	}
+}
+
+func TestOrderTypes(t *testing.T) {
+	in := LimitOrderExecuteInput{Order: Order{OrderType: big.NewInt(2)}}
+	// every type is accepted until the types of the contract are registered
+	assert.NoError(t, in.ValidateType())
+
+	t.Cleanup(func() { unregisterOrderType(1) })
+	assert.NoError(t, RegisterOrderType(OrderTypeSpec{ID: 1, Name: "test_stop_loss", RequiresRoutes: true, RequiresTrigger: true}))
+	spec, ok := LookupOrderType(big.NewInt(1))
+	assert.True(t, ok)
+	assert.Equal(t, "test_stop_loss", spec.Name)
+	byName, ok := OrderTypeByName("test_stop_loss")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), byName.ID)
+	_, ok = LookupOrderType(nil)
+	assert.False(t, ok)
+	_, ok = LookupOrderType(new(big.Int).Lsh(big.NewInt(1), 64))
+	assert.False(t, ok)
+	assert.ErrorIs(t, in.ValidateType(), ErrUnknownOrderType)
+
+	assert.Error(t, RegisterOrderType(OrderTypeSpec{ID: 1, Name: "other"}))
+	assert.Error(t, RegisterOrderType(OrderTypeSpec{ID: 1000, Name: "test_stop_loss"}))
+	assert.Error(t, RegisterOrderType(OrderTypeSpec{ID: 1000}))
+
+	errTooSmall := errors.New("too small")
+	built := 0
+	t.Cleanup(func() { unregisterOrderType(1000) })
+	assert.NoError(t, RegisterOrderType(OrderTypeSpec{
+		ID:   1000,
+		Name: "test_routeless",
+		Validate: func(in *LimitOrderExecuteInput) error {
+			if in.AmountIn.Cmp(big.NewInt(10)) < 0 {
+				return errTooSmall
+			}
+			return nil
+		},
+		Build: func(in *LimitOrderExecuteInput) error {
+			built++
+			return nil
+		},
+	}))
+	in = LimitOrderExecuteInput{
+		Order:             Order{Account: common.HexToAddress("0x1111111111111111111111111111111111111111"), Index: big.NewInt(1), OrderType: big.NewInt(1000), ExecuteFee: big.NewInt(0)},
+		RemainingAmountIn: big.NewInt(100),
+		AmountIn:          big.NewInt(100),
+		AmountOutMin:      big.NewInt(0),
+		AmountOutExpected: big.NewInt(0),
+	}
+	assert.Equal(t, "test_routeless", in.Order.TypeName())
+	// the type doesn't require routes
+	assert.NoError(t, in.Validate())
+	assert.NoError(t, in.ValidateType())
+	in.AmountIn = big.NewInt(1)
+	assert.ErrorIs(t, in.ValidateType(), errTooSmall)
+	assert.NoError(t, in.Build())
+	assert.Equal(t, 1, built)
+
+	in.Order.OrderType = big.NewInt(1001)
+	assert.Equal(t, "1001", in.Order.TypeName())
+	assert.ErrorIs(t, in.Validate(), ErrNoRoute)
+	assert.ErrorIs(t, in.ValidateType(), ErrUnknownOrderType)
+	assert.NoError(t, in.Build())
+}
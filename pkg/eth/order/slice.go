@@ -0,0 +1,47 @@
+package order
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Slice returns in scaled down to amountIn, RemainingAmountIn is kept
+func (in *LimitOrderExecuteInput) Slice(amountIn *big.Int) (*LimitOrderExecuteInput, error) {
+	if in.AmountIn == nil || in.AmountIn.Sign() <= 0 {
+		return nil, &ValidationError{Field: "amountIn", Err: ErrInvalidAmount, Detail: "must be positive"}
+	}
+	if amountIn == nil || amountIn.Sign() <= 0 || amountIn.Cmp(in.AmountIn) > 0 {
+		return nil, fmt.Errorf("%w: slice %v of %s", ErrInvalidAmount, amountIn, in.AmountIn)
+	}
+	scale := func(v *big.Int) *big.Int {
+		if v == nil {
+			return nil
+		}
+		scaled := new(big.Int).Mul(v, amountIn)
+		return scaled.Quo(scaled, in.AmountIn)
+	}
+	out := *in
+	out.AmountIn = new(big.Int).Set(amountIn)
+	out.AmountOutMin = scale(in.AmountOutMin)
+	out.AmountOutExpected = scale(in.AmountOutExpected)
+	out.Routes = make([]SwapRoute, len(in.Routes))
+	// the routes spending the input, the next hops carry 0
+	var (
+		spending []int
+		weights  []*big.Int
+	)
+	for i, route := range in.Routes {
+		out.Routes[i] = route
+		out.Routes[i].AmountOutMin = scale(route.AmountOutMin)
+		if route.AmountIn != nil && route.AmountIn.Sign() > 0 {
+			spending = append(spending, i)
+			weights = append(weights, route.AmountIn)
+		}
+	}
+	if len(spending) > 0 {
+		for i, share := range proportion(amountIn, weights) {
+			out.Routes[spending[i]].AmountIn = share
+		}
+	}
+	return &out, nil
+}
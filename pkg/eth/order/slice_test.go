@@ -0,0 +1,58 @@
+package order
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitOrderExecuteInput_Slice(t *testing.T) {
+	a := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	b := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	c := common.HexToAddress("0xcccccccccccccccccccccccccccccccccccccccc")
+	in := LimitOrderExecuteInput{
+		Order:             Order{Index: big.NewInt(1), OrderType: big.NewInt(0), ExecuteFee: big.NewInt(0)},
+		TokenIn:           a,
+		TokenOut:          c,
+		RemainingAmountIn: big.NewInt(5000),
+		Routes: []SwapRoute{
+			{DexId: 1, TokenIn: a, TokenOut: b, AmountIn: big.NewInt(250), AmountOutMin: big.NewInt(100)},
+			{DexId: 2, TokenIn: a, TokenOut: b, AmountIn: big.NewInt(750), AmountOutMin: big.NewInt(300)},
+			{DexId: 3, TokenIn: b, TokenOut: c, AmountIn: big.NewInt(0), AmountOutMin: big.NewInt(1990)},
+		},
+		AmountIn:          big.NewInt(1000),
+		AmountOutMin:      big.NewInt(1990),
+		AmountOutExpected: big.NewInt(2001),
+	}
+	amounts := func(in *LimitOrderExecuteInput) (string, string) {
+		var amountIns, mins []*big.Int
+		for _, r := range in.Routes {
+			amountIns = append(amountIns, r.AmountIn)
+			mins = append(mins, r.AmountOutMin)
+		}
+		return bigs(amountIns), bigs(mins)
+	}
+
+	// a third, 333 split 1/4 3/4 with the remainder on the last spending route
+	slice, err := in.Slice(big.NewInt(333))
+	assert.NoError(t, err)
+	amountIns, mins := amounts(slice)
+	assert.Equal(t, "[83 250 0]", amountIns)
+	assert.Equal(t, "[33 99 662]", mins)
+	assert.Equal(t, "[333 662 666 5000]", bigs([]*big.Int{slice.AmountIn, slice.AmountOutMin, slice.AmountOutExpected, slice.RemainingAmountIn}))
+	assert.NoError(t, slice.Validate())
+	// in is untouched
+	amountIns, _ = amounts(&in)
+	assert.Equal(t, "[250 750 0]", amountIns)
+
+	slice, err = in.Slice(big.NewInt(1000))
+	assert.NoError(t, err)
+	assert.Equal(t, mustJSON(t, &in), mustJSON(t, slice))
+
+	for _, amountIn := range []*big.Int{nil, big.NewInt(0), big.NewInt(1001)} {
+		_, err = in.Slice(amountIn)
+		assert.ErrorIs(t, err, ErrInvalidAmount, "%v", amountIn)
+	}
+}
@@ -0,0 +1,115 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// MaxBps is 100% in basis points
+const MaxBps = 10000
+
+var (
+	ErrInvalidSlippage = errors.New("invalid slippage")
+	ErrInvalidSplit    = errors.New("invalid split")
+)
+
+// MinAmountOut is expected less slippageBps, rounded down
+func MinAmountOut(expected *big.Int, slippageBps uint64) (*big.Int, error) {
+	if slippageBps > MaxBps {
+		return nil, fmt.Errorf("%w: %d bps", ErrInvalidSlippage, slippageBps)
+	}
+	if expected == nil || expected.Sign() < 0 {
+		return nil, fmt.Errorf("%w: expected amount %v", ErrInvalidAmount, expected)
+	}
+	min := new(big.Int).Mul(expected, big.NewInt(int64(MaxBps-slippageBps)))
+	return min.Quo(min, big.NewInt(MaxBps)), nil
+}
+
+// SplitAmount divides amount into shares of sharesBps, the last one takes the remainder
+func SplitAmount(amount *big.Int, sharesBps []uint64) ([]*big.Int, error) {
+	if amount == nil || amount.Sign() < 0 {
+		return nil, fmt.Errorf("%w: amount %v", ErrInvalidAmount, amount)
+	}
+	var total uint64
+	weights := make([]*big.Int, len(sharesBps))
+	for i, bps := range sharesBps {
+		total += bps
+		weights[i] = new(big.Int).SetUint64(bps)
+	}
+	if total != MaxBps {
+		return nil, fmt.Errorf("%w: shares add up to %d bps", ErrInvalidSplit, total)
+	}
+	return proportion(amount, weights), nil
+}
+
+// proportion divides amount in proportion of weights, which add up to a positive total
+func proportion(amount *big.Int, weights []*big.Int) []*big.Int {
+	total := new(big.Int)
+	for _, w := range weights {
+		total.Add(total, w)
+	}
+	shares := make([]*big.Int, len(weights))
+	rest := new(big.Int).Set(amount)
+	for i, w := range weights {
+		if i == len(weights)-1 {
+			shares[i] = rest
+			break
+		}
+		shares[i] = new(big.Int).Mul(amount, w)
+		shares[i].Quo(shares[i], total)
+		rest.Sub(rest, shares[i])
+	}
+	return shares
+}
+
+// ApplySlippage sets AmountOutMin and the minimums of the routes ending with tokenOut to AmountOutExpected less slippageBps
+func (in *LimitOrderExecuteInput) ApplySlippage(slippageBps uint64) error {
+	min, err := MinAmountOut(in.AmountOutExpected, slippageBps)
+	if err != nil {
+		return &ValidationError{Field: "amountOutExpected", Err: err}
+	}
+	if len(in.Routes) == 0 {
+		return &ValidationError{Field: "routes", Err: ErrNoRoute}
+	}
+	var last []int
+	direct := true
+	for i, route := range in.Routes {
+		if route.TokenOut == in.TokenOut {
+			last = append(last, i)
+		}
+		direct = direct && route.TokenIn == in.TokenIn && route.TokenOut == in.TokenOut
+	}
+	if !direct {
+		in.AmountOutMin = min
+		if len(last) == 1 {
+			in.Routes[last[0]].AmountOutMin = min
+		}
+		return nil
+	}
+
+	weights := make([]*big.Int, len(in.Routes))
+	total := new(big.Int)
+	for i, route := range in.Routes {
+		if route.AmountIn == nil || route.AmountIn.Sign() < 0 {
+			return &ValidationError{Field: fmt.Sprintf("routes[%d]", i), Err: ErrInvalidAmount}
+		}
+		weights[i] = route.AmountIn
+		total.Add(total, route.AmountIn)
+	}
+	if total.Sign() == 0 {
+		return &ValidationError{Field: "routes", Err: ErrInvalidSplit, Detail: "routes without amountIn"}
+	}
+
+	routeMins := make([]*big.Int, len(in.Routes))
+	for i, expected := range proportion(in.AmountOutExpected, weights) {
+		if routeMins[i], err = MinAmountOut(expected, slippageBps); err != nil {
+			return err
+		}
+	}
+	in.AmountOutMin = min
+	for i := range in.Routes {
+		in.Routes[i].AmountOutMin = routeMins[i]
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package order
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinAmountOut(t *testing.T) {
+	for _, tc := range []struct {
+		expected *big.Int
+		bps      uint64
+		want     *big.Int
+	}{
+		{big.NewInt(10000), 50, big.NewInt(9950)},
+		// 999 * 0.995 = 994.005
+		{big.NewInt(999), 50, big.NewInt(994)},
+		{big.NewInt(1), 1, big.NewInt(0)},
+		{big.NewInt(1234), 0, big.NewInt(1234)},
+		{big.NewInt(1234), MaxBps, big.NewInt(0)},
+		{new(big.Int).Lsh(big.NewInt(1), 255), 5000, new(big.Int).Lsh(big.NewInt(1), 254)},
+	} {
+		got, err := MinAmountOut(tc.expected, tc.bps)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, tc.want.Cmp(got), "%s less %d bps: %s", tc.expected, tc.bps, got)
+	}
+
+	_, err := MinAmountOut(big.NewInt(1), MaxBps+1)
+	assert.ErrorIs(t, err, ErrInvalidSlippage)
+	_, err = MinAmountOut(nil, 50)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+}
+
+func TestSplitAmount(t *testing.T) {
+	shares, err := SplitAmount(big.NewInt(1001), []uint64{3333, 3333, 3334})
+	assert.NoError(t, err)
+	assert.Equal(t, "[333 333 335]", bigs(shares))
+
+	shares, err = SplitAmount(big.NewInt(1000), []uint64{MaxBps})
+	assert.NoError(t, err)
+	assert.Equal(t, "[1000]", bigs(shares))
+
+	_, err = SplitAmount(big.NewInt(1000), []uint64{5000, 4000})
+	assert.ErrorIs(t, err, ErrInvalidSplit)
+}
+
+func TestLimitOrderExecuteInput_ApplySlippage(t *testing.T) {
+	a := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	b := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	c := common.HexToAddress("0xcccccccccccccccccccccccccccccccccccccccc")
+	route := func(dexId uint16, tokenIn, tokenOut common.Address, amountIn int64) SwapRoute {
+		return SwapRoute{DexId: dexId, TokenIn: tokenIn, TokenOut: tokenOut, AmountIn: big.NewInt(amountIn), AmountOutMin: big.NewInt(7)}
+	}
+	mins := func(in *LimitOrderExecuteInput) string {
+		var v []*big.Int
+		for _, r := range in.Routes {
+			v = append(v, r.AmountOutMin)
+		}
+		return bigs(v)
+	}
+
+	for name, tc := range map[string]struct {
+		routes   []SwapRoute
+		expected int64
+		want     string
+	}{
+		"single":    {[]SwapRoute{route(1, a, c, 1000)}, 2000, "[1990]"},
+		"multi hop": {[]SwapRoute{route(1, a, b, 1000), route(2, b, c, 0)}, 2000, "[7 1990]"},
+		// 2001 expected split 1/4 3/4: 500 and 1501, less 0.5%
+		"split": {[]SwapRoute{route(1, a, c, 250), route(2, a, c, 750)}, 2001, "[497 1493]"},
+		// the split of the output of the first hop is not known
+		"split last hop": {[]SwapRoute{route(1, a, b, 1000), route(2, b, c, 0), route(3, b, c, 0)}, 2001, "[7 7 7]"},
+		"direct and hop": {[]SwapRoute{route(1, a, b, 400), route(2, a, c, 600), route(3, b, c, 0)}, 2000, "[7 7 7]"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			in := LimitOrderExecuteInput{
+				Order:             Order{Index: big.NewInt(1), OrderType: big.NewInt(0), ExecuteFee: big.NewInt(0)},
+				TokenIn:           a,
+				TokenOut:          c,
+				Routes:            tc.routes,
+				RemainingAmountIn: big.NewInt(1000),
+				AmountIn:          big.NewInt(1000),
+				AmountOutExpected: big.NewInt(tc.expected),
+			}
+			assert.NoError(t, in.ApplySlippage(50))
+			assert.Equal(t, tc.want, mins(&in))
+			assert.Equal(t, 0, in.AmountOutMin.Cmp(new(big.Int).Quo(new(big.Int).Mul(in.AmountOutExpected, big.NewInt(9950)), big.NewInt(MaxBps))))
+			assert.NoError(t, in.Validate())
+		})
+	}
+
+	in := LimitOrderExecuteInput{TokenIn: a, TokenOut: c, Routes: []SwapRoute{route(1, a, c, 0), route(2, a, c, 0)}, AmountOutExpected: big.NewInt(2000)}
+	assert.ErrorIs(t, in.ApplySlippage(50), ErrInvalidSplit)
+	in = LimitOrderExecuteInput{Routes: []SwapRoute{route(1, a, c, 1000)}, AmountOutExpected: big.NewInt(2000)}
+	assert.ErrorIs(t, in.ApplySlippage(MaxBps+1), ErrInvalidSlippage)
+	in.Routes = nil
+	assert.ErrorIs(t, in.ApplySlippage(50), ErrNoRoute)
+}
+
+func bigs(v []*big.Int) string {
+	s := "["
+	for i, x := range v {
+		if i > 0 {
+			s += " "
+		}
+		s += x.String()
+	}
+	return s + "]"
+}
@@ -0,0 +1,134 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TriggerSource is the kind of the price feed of a Trigger
+type TriggerSource string
+
+const (
+	// a Chainlink aggregator, the price is the answer of latestRoundData
+	TriggerSourceChainlink TriggerSource = "chainlink"
+	// a Uniswap V2 pair, the price is reserve1 / reserve0 scaled by 1e18
+	TriggerSourceUniswapV2 TriggerSource = "uniswap_v2"
+)
+
+const triggerFeedABI = `[` +
+	`{"inputs":[],"name":"latestRoundData","outputs":[{"name":"roundId","type":"uint80"},{"name":"answer","type":"int256"},{"name":"startedAt","type":"uint256"},{"name":"updatedAt","type":"uint256"},{"name":"answeredInRound","type":"uint80"}],"stateMutability":"view","type":"function"},` +
+	`{"inputs":[],"name":"getReserves","outputs":[{"name":"reserve0","type":"uint112"},{"name":"reserve1","type":"uint112"},{"name":"blockTimestampLast","type":"uint32"}],"stateMutability":"view","type":"function"}` +
+	`]`
+
+var (
+	ErrInvalidTrigger = errors.New("invalid trigger")
+	ErrStalePrice     = errors.New("stale price")
+)
+
+var (
+	triggerFeed abi.ABI
+	priceScale  = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+)
+
+func init() {
+	var err error
+	triggerFeed, err = abi.JSON(strings.NewReader(triggerFeedABI))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Trigger holds a stop-loss or take-profit order until the price of Feed crosses Threshold
+type Trigger struct {
+	Source TriggerSource
+	// the aggregator or the pair
+	Feed common.Address
+	// the price in the unit of the source, raw amounts for a pair
+	Threshold *big.Int
+	// crossed when the price is at or above Threshold, otherwise at or below
+	Above bool
+	// uniswap_v2: the price of token1 in token0, reserve0 / reserve1
+	Inverse bool
+	// chainlink: an answer updated longer than MaxAge ago is stale, unchecked when 0
+	MaxAge time.Duration
+	// how often the keeper reads the feed until the trigger is crossed
+	PollInterval time.Duration
+}
+
+func (t *Trigger) Validate() error {
+	switch t.Source {
+	case TriggerSourceChainlink, TriggerSourceUniswapV2:
+	default:
+		return fmt.Errorf("%w: unknown source %q", ErrInvalidTrigger, t.Source)
+	}
+	if t.Feed == (common.Address{}) {
+		return fmt.Errorf("%w: feed is required", ErrInvalidTrigger)
+	}
+	if t.Threshold == nil || t.Threshold.Sign() <= 0 {
+		return fmt.Errorf("%w: threshold must be positive", ErrInvalidTrigger)
+	}
+	if t.MaxAge < 0 || t.PollInterval < 0 {
+		return fmt.Errorf("%w: negative duration", ErrInvalidTrigger)
+	}
+	return nil
+}
+
+// Crossed tells whether price reached the threshold
+func (t *Trigger) Crossed(price *big.Int) bool {
+	if t.Above {
+		return price.Cmp(t.Threshold) >= 0
+	}
+	return price.Cmp(t.Threshold) <= 0
+}
+
+// Check reads the price of the feed and tells whether it crossed the threshold
+func (t *Trigger) Check(ctx context.Context, caller bind.ContractCaller) (bool, *big.Int, error) {
+	price, err := t.Price(ctx, caller)
+	if err != nil {
+		return false, nil, err
+	}
+	return t.Crossed(price), price, nil
+}
+
+// Price reads the price of the feed
+func (t *Trigger) Price(ctx context.Context, caller bind.ContractCaller) (*big.Int, error) {
+	feed := bind.NewBoundContract(t.Feed, triggerFeed, caller, nil, nil)
+	opts := &bind.CallOpts{Context: ctx}
+	var out []interface{}
+	switch t.Source {
+	case TriggerSourceChainlink:
+		if err := feed.Call(opts, &out, "latestRoundData"); err != nil {
+			return nil, fmt.Errorf("latestRoundData of %s: %w", t.Feed.Hex(), err)
+		}
+		answer, updatedAt := out[1].(*big.Int), out[3].(*big.Int)
+		if answer.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: answer %s of %s", ErrStalePrice, answer, t.Feed.Hex())
+		}
+		if t.MaxAge > 0 && time.Since(time.Unix(updatedAt.Int64(), 0)) > t.MaxAge {
+			return nil, fmt.Errorf("%w: %s updated at %s", ErrStalePrice, t.Feed.Hex(), updatedAt)
+		}
+		return answer, nil
+	case TriggerSourceUniswapV2:
+		if err := feed.Call(opts, &out, "getReserves"); err != nil {
+			return nil, fmt.Errorf("getReserves of %s: %w", t.Feed.Hex(), err)
+		}
+		base, quote := out[0].(*big.Int), out[1].(*big.Int)
+		if t.Inverse {
+			base, quote = quote, base
+		}
+		if base.Sign() == 0 {
+			return nil, fmt.Errorf("%w: empty pair %s", ErrStalePrice, t.Feed.Hex())
+		}
+		price := new(big.Int).Mul(quote, priceScale)
+		return price.Quo(price, base), nil
+	}
+	return nil, fmt.Errorf("%w: unknown source %q", ErrInvalidTrigger, t.Source)
+}
@@ -0,0 +1,127 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// feedCaller answers the calls of a feed contract with the outputs of its method
+type feedCaller struct {
+	outputs map[string][]interface{}
+	err     error
+}
+
+func (c *feedCaller) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return []byte{0x60}, nil
+}
+
+func (c *feedCaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	method, err := triggerFeed.MethodById(call.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	return method.Outputs.Pack(c.outputs[method.Name]...)
+}
+
+func roundData(answer int64, updatedAt time.Time) []interface{} {
+	return []interface{}{big.NewInt(1), big.NewInt(answer), big.NewInt(updatedAt.Unix()), big.NewInt(updatedAt.Unix()), big.NewInt(1)}
+}
+
+func TestTrigger_Check(t *testing.T) {
+	ctx := context.Background()
+	feed := common.HexToAddress("0xfeed")
+	now := time.Now()
+
+	for name, tc := range map[string]struct {
+		trigger Trigger
+		outputs map[string][]interface{}
+		crossed bool
+		price   string
+		err     error
+	}{
+		"stop-loss above threshold": {
+			trigger: Trigger{Source: TriggerSourceChainlink, Feed: feed, Threshold: big.NewInt(2000_00000000)},
+			outputs: map[string][]interface{}{"latestRoundData": roundData(2100_00000000, now)},
+			price:   "210000000000",
+		},
+		"stop-loss crossed": {
+			trigger: Trigger{Source: TriggerSourceChainlink, Feed: feed, Threshold: big.NewInt(2000_00000000)},
+			outputs: map[string][]interface{}{"latestRoundData": roundData(1999_00000000, now)},
+			crossed: true,
+			price:   "199900000000",
+		},
+		"take-profit at threshold": {
+			trigger: Trigger{Source: TriggerSourceChainlink, Feed: feed, Threshold: big.NewInt(2000_00000000), Above: true},
+			outputs: map[string][]interface{}{"latestRoundData": roundData(2000_00000000, now)},
+			crossed: true,
+			price:   "200000000000",
+		},
+		"stale answer": {
+			trigger: Trigger{Source: TriggerSourceChainlink, Feed: feed, Threshold: big.NewInt(1), MaxAge: time.Hour},
+			outputs: map[string][]interface{}{"latestRoundData": roundData(1, now.Add(-2*time.Hour))},
+			err:     ErrStalePrice,
+		},
+		"negative answer": {
+			trigger: Trigger{Source: TriggerSourceChainlink, Feed: feed, Threshold: big.NewInt(1)},
+			outputs: map[string][]interface{}{"latestRoundData": roundData(-1, now)},
+			err:     ErrStalePrice,
+		},
+		"pair price": {
+			// 1 token0 for 2500.5 token1
+			trigger: Trigger{Source: TriggerSourceUniswapV2, Feed: feed, Threshold: new(big.Int).Mul(big.NewInt(2500), priceScale), Above: true},
+			outputs: map[string][]interface{}{"getReserves": {big.NewInt(1000), big.NewInt(2500500), uint32(now.Unix())}},
+			crossed: true,
+			price:   "2500500000000000000000",
+		},
+		"inverse pair price": {
+			trigger: Trigger{Source: TriggerSourceUniswapV2, Feed: feed, Threshold: big.NewInt(400000000000000), Inverse: true},
+			outputs: map[string][]interface{}{"getReserves": {big.NewInt(1000), big.NewInt(2500500), uint32(now.Unix())}},
+			crossed: true,
+			price:   "399920015996800",
+		},
+		"empty pair": {
+			trigger: Trigger{Source: TriggerSourceUniswapV2, Feed: feed, Threshold: big.NewInt(1)},
+			outputs: map[string][]interface{}{"getReserves": {big.NewInt(0), big.NewInt(0), uint32(0)}},
+			err:     ErrStalePrice,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, tc.trigger.Validate())
+			crossed, price, err := tc.trigger.Check(ctx, &feedCaller{outputs: tc.outputs})
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.crossed, crossed)
+			assert.Equal(t, tc.price, price.String())
+		})
+	}
+
+	callErr := errors.New("rpc down")
+	_, _, err := (&Trigger{Source: TriggerSourceChainlink, Feed: feed, Threshold: big.NewInt(1)}).Check(ctx, &feedCaller{err: callErr})
+	assert.ErrorIs(t, err, callErr)
+}
+
+func TestTrigger_Validate(t *testing.T) {
+	feed := common.HexToAddress("0xfeed")
+	for name, trigger := range map[string]Trigger{
+		"source":    {Source: "twap", Feed: feed, Threshold: big.NewInt(1)},
+		"feed":      {Source: TriggerSourceChainlink, Threshold: big.NewInt(1)},
+		"threshold": {Source: TriggerSourceChainlink, Feed: feed},
+		"zero":      {Source: TriggerSourceChainlink, Feed: feed, Threshold: big.NewInt(0)},
+		"interval":  {Source: TriggerSourceChainlink, Feed: feed, Threshold: big.NewInt(1), PollInterval: -time.Second},
+	} {
+		assert.ErrorIs(t, trigger.Validate(), ErrInvalidTrigger, name)
+	}
+}
@@ -0,0 +1,117 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	ErrInvalidAmount            = errors.New("invalid amount")
+	ErrNoRoute                  = errors.New("no route")
+	ErrBrokenRoute              = errors.New("routes do not chain tokenIn to tokenOut")
+	ErrRouteAmountMismatch      = errors.New("routes swapping tokenIn do not add up to amountIn")
+	ErrAmountOutMinTooHigh      = errors.New("amountOutMin exceeds amountOutExpected")
+	ErrAmountInExceedsRemaining = errors.New("amountIn exceeds remainingAmountIn")
+)
+
+// ValidationError reports the field of a LimitOrderExecuteInput rejected by Validate
+type ValidationError struct {
+	Field  string
+	Err    error
+	Detail string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Err)
+	}
+	return fmt.Sprintf("%s: %s, %s", e.Field, e.Err, e.Detail)
+}
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// Validate checks that in can be executed as is, with uint256 amounts and routes from tokenIn to tokenOut
+func (in *LimitOrderExecuteInput) Validate() error {
+	for _, amount := range []struct {
+		field string
+		value *big.Int
+	}{
+		{"order.index", in.Order.Index},
+		{"order.orderType", in.Order.OrderType},
+		{"order.executeFee", in.Order.ExecuteFee},
+		{"amountIn", in.AmountIn},
+		{"amountOutMin", in.AmountOutMin},
+		{"amountOutExpected", in.AmountOutExpected},
+		{"remainingAmountIn", in.RemainingAmountIn},
+	} {
+		if err := validateUint256(amount.field, amount.value); err != nil {
+			return err
+		}
+	}
+	if in.AmountIn.Sign() == 0 {
+		return &ValidationError{Field: "amountIn", Err: ErrInvalidAmount, Detail: "zero"}
+	}
+	if in.AmountIn.Cmp(in.RemainingAmountIn) > 0 {
+		return &ValidationError{Field: "amountIn", Err: ErrAmountInExceedsRemaining, Detail: fmt.Sprintf("%s > %s", in.AmountIn, in.RemainingAmountIn)}
+	}
+	if in.AmountOutMin.Cmp(in.AmountOutExpected) > 0 {
+		return &ValidationError{Field: "amountOutMin", Err: ErrAmountOutMinTooHigh, Detail: fmt.Sprintf("%s > %s", in.AmountOutMin, in.AmountOutExpected)}
+	}
+	return in.validateRoutes()
+}
+
+// validateUint256 rejects the values the ABI encoding would wrap around
+func validateUint256(field string, v *big.Int) error {
+	switch {
+	case v == nil:
+		return &ValidationError{Field: field, Err: ErrInvalidAmount, Detail: "missing"}
+	case v.Sign() < 0:
+		return &ValidationError{Field: field, Err: ErrInvalidAmount, Detail: "negative " + v.String()}
+	case v.BitLen() > 256:
+		return &ValidationError{Field: field, Err: ErrInvalidAmount, Detail: "above the uint256 range"}
+	}
+	return nil
+}
+
+func (in *LimitOrderExecuteInput) validateRoutes() error {
+	if len(in.Routes) == 0 {
+		if spec, ok := LookupOrderType(in.Order.OrderType); ok && !spec.RequiresRoutes {
+			return nil
+		}
+		return &ValidationError{Field: "routes", Err: ErrNoRoute}
+	}
+	if in.Routes[0].TokenIn != in.TokenIn {
+		return &ValidationError{Field: "routes[0].tokenIn", Err: ErrBrokenRoute, Detail: fmt.Sprintf("%s, want %s", in.Routes[0].TokenIn.Hex(), in.TokenIn.Hex())}
+	}
+	held := map[common.Address]bool{in.TokenIn: true}
+	total := new(big.Int)
+	for i, route := range in.Routes {
+		field := fmt.Sprintf("routes[%d]", i)
+		if route.TokenIn == route.TokenOut {
+			return &ValidationError{Field: field, Err: ErrBrokenRoute, Detail: "tokenIn equals tokenOut"}
+		}
+		if !held[route.TokenIn] {
+			return &ValidationError{Field: field + ".tokenIn", Err: ErrBrokenRoute, Detail: fmt.Sprintf("%s is neither tokenIn nor the output of a previous route", route.TokenIn.Hex())}
+		}
+		held[route.TokenOut] = true
+		if err := validateUint256(field+".amountIn", route.AmountIn); err != nil {
+			return err
+		}
+		if err := validateUint256(field+".amountOutMin", route.AmountOutMin); err != nil {
+			return err
+		}
+		if route.TokenIn == in.TokenIn {
+			total.Add(total, route.AmountIn)
+		}
+	}
+	if last := in.Routes[len(in.Routes)-1]; last.TokenOut != in.TokenOut {
+		return &ValidationError{Field: fmt.Sprintf("routes[%d].tokenOut", len(in.Routes)-1), Err: ErrBrokenRoute, Detail: fmt.Sprintf("%s, want %s", last.TokenOut.Hex(), in.TokenOut.Hex())}
+	}
+	if total.Cmp(in.AmountIn) != 0 {
+		return &ValidationError{Field: "routes", Err: ErrRouteAmountMismatch, Detail: fmt.Sprintf("%s, want %s", total, in.AmountIn)}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package order
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitOrderExecuteInput_Validate(t *testing.T) {
+	a := common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	b := common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	c := common.HexToAddress("0xcccccccccccccccccccccccccccccccccccccccc")
+	d := common.HexToAddress("0xdddddddddddddddddddddddddddddddddddddddd")
+	route := func(tokenIn, tokenOut common.Address, amountIn int64) SwapRoute {
+		return SwapRoute{TokenIn: tokenIn, TokenOut: tokenOut, AmountIn: big.NewInt(amountIn), AmountOutMin: big.NewInt(0)}
+	}
+	valid := func() LimitOrderExecuteInput {
+		return LimitOrderExecuteInput{
+			Order:             Order{Index: big.NewInt(1), OrderType: big.NewInt(0), ExecuteFee: big.NewInt(0)},
+			TokenIn:           a,
+			TokenOut:          c,
+			RemainingAmountIn: big.NewInt(2000),
+			Routes:            []SwapRoute{route(a, b, 1000), route(b, c, 0)},
+			AmountIn:          big.NewInt(1000),
+			AmountOutMin:      big.NewInt(900),
+			AmountOutExpected: big.NewInt(950),
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		modify func(in *LimitOrderExecuteInput)
+		err    error
+		field  string
+	}{
+		"valid":      {modify: func(in *LimitOrderExecuteInput) {}},
+		"single hop": {modify: func(in *LimitOrderExecuteInput) { in.TokenOut = b; in.Routes = in.Routes[:1] }},
+		"split": {modify: func(in *LimitOrderExecuteInput) {
+			in.Routes = []SwapRoute{route(a, b, 400), route(a, b, 600), route(b, c, 0)}
+		}},
+		"nil amountIn":      {modify: func(in *LimitOrderExecuteInput) { in.AmountIn = nil }, err: ErrInvalidAmount, field: "amountIn"},
+		"zero amountIn":     {modify: func(in *LimitOrderExecuteInput) { in.AmountIn = big.NewInt(0) }, err: ErrInvalidAmount, field: "amountIn"},
+		"negative minimum":  {modify: func(in *LimitOrderExecuteInput) { in.AmountOutMin = big.NewInt(-1) }, err: ErrInvalidAmount, field: "amountOutMin"},
+		"nil remaining":     {modify: func(in *LimitOrderExecuteInput) { in.RemainingAmountIn = nil }, err: ErrInvalidAmount, field: "remainingAmountIn"},
+		"above remaining":   {modify: func(in *LimitOrderExecuteInput) { in.RemainingAmountIn = big.NewInt(999) }, err: ErrAmountInExceedsRemaining, field: "amountIn"},
+		"minimum too high":  {modify: func(in *LimitOrderExecuteInput) { in.AmountOutMin = big.NewInt(951) }, err: ErrAmountOutMinTooHigh, field: "amountOutMin"},
+		"no route":          {modify: func(in *LimitOrderExecuteInput) { in.Routes = nil }, err: ErrNoRoute, field: "routes"},
+		"wrong first token": {modify: func(in *LimitOrderExecuteInput) { in.Routes[0].TokenIn = c }, err: ErrBrokenRoute, field: "routes[0].tokenIn"},
+		"broken chain":      {modify: func(in *LimitOrderExecuteInput) { in.Routes[1].TokenIn = d }, err: ErrBrokenRoute, field: "routes[1].tokenIn"},
+		"direct and hop": {modify: func(in *LimitOrderExecuteInput) {
+			in.Routes = []SwapRoute{route(a, b, 400), route(a, c, 600), route(b, c, 380)}
+		}},
+		"above uint256": {modify: func(in *LimitOrderExecuteInput) {
+			in.AmountOutExpected = new(big.Int).Lsh(big.NewInt(1), 256)
+		}, err: ErrInvalidAmount, field: "amountOutExpected"},
+		"route above uint256": {modify: func(in *LimitOrderExecuteInput) {
+			in.Routes[1].AmountOutMin = new(big.Int).Lsh(big.NewInt(1), 256)
+		}, err: ErrInvalidAmount, field: "routes[1].amountOutMin"},
+		"nil order index":  {modify: func(in *LimitOrderExecuteInput) { in.Order.Index = nil }, err: ErrInvalidAmount, field: "order.index"},
+		"wrong last token": {modify: func(in *LimitOrderExecuteInput) { in.Routes[1].TokenOut = a }, err: ErrBrokenRoute, field: "routes[1].tokenOut"},
+		"same tokens":      {modify: func(in *LimitOrderExecuteInput) { in.Routes[1].TokenIn = c }, err: ErrBrokenRoute, field: "routes[1]"},
+		"nil route amount": {modify: func(in *LimitOrderExecuteInput) { in.Routes[1].AmountOutMin = nil }, err: ErrInvalidAmount, field: "routes[1].amountOutMin"},
+		"amounts mismatch": {modify: func(in *LimitOrderExecuteInput) { in.Routes[0].AmountIn = big.NewInt(900) }, err: ErrRouteAmountMismatch, field: "routes"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			in := valid()
+			tc.modify(&in)
+			err := in.Validate()
+			if tc.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.err)
+			var verr *ValidationError
+			if assert.ErrorAs(t, err, &verr) {
+				assert.Equal(t, tc.field, verr.Field)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hibiken/asynq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "wetask"
+
+// Registry holds every metric of the package with the go and process collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	tasksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_total",
+		Help:      "Tasks processed by type and outcome.",
+	}, []string{"type", "outcome"})
+	taskDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "task_duration_seconds",
+		Help:      "Time spent processing a task.",
+		Buckets:   []float64{.1, .5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"type"})
+	checkUpkeepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "check_upkeep_duration_seconds",
+		Help:      "Latency of the checkUpkeep calls.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"network"})
+	inclusionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "inclusion_duration_seconds",
+		Help:      "Time from the first transaction sent to its receipt.",
+		Buckets:   []float64{1, 2, 5, 10, 15, 30, 60, 120, 300},
+	}, []string{"network"})
+	feeBumps = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "fee_bumps",
+		Help:      "Replacement transactions sent with a higher fee per task.",
+		Buckets:   []float64{0, 1, 2, 3, 5},
+	}, []string{"network"})
+	gasUsed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gas_used_total",
+		Help:      "Gas used by the transactions of a keeper.",
+	}, []string{"network", "keeper"})
+	gasSpent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gas_spent_wei_total",
+		Help:      "Fees paid by a keeper, in wei.",
+	}, []string{"network", "keeper"})
+	inflightNonces = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "inflight_nonces",
+		Help:      "Nonces handed out and not released yet by a keeper.",
+	}, []string{"keeper"})
+	rpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_requests_total",
+		Help:      "JSON-RPC requests by endpoint and method.",
+	}, []string{"network", "endpoint", "method"})
+	rpcErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_errors_total",
+		Help:      "Failed JSON-RPC requests by endpoint and method.",
+	}, []string{"network", "endpoint", "method"})
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Latency of the JSON-RPC requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"network", "endpoint", "method"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		tasksTotal, taskDuration,
+		checkUpkeepDuration, inclusionDuration, feeBumps,
+		gasUsed, gasSpent, inflightNonces,
+		rpcRequests, rpcErrors, rpcDuration,
+	)
+}
+
+// Handler serves Registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+type outcomeKey struct{}
+
+type outcome struct {
+	value string
+}
+
+// SetOutcome labels the task handled under Middleware, such as "executed" or "reverted"
+func SetOutcome(ctx context.Context, value string) {
+	if o, ok := ctx.Value(outcomeKey{}).(*outcome); ok {
+		o.value = value
+	}
+}
+
+// Middleware counts the tasks by type and by the outcome set by the handler
+func Middleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		o := new(outcome)
+		start := time.Now()
+		err := next.ProcessTask(context.WithValue(ctx, outcomeKey{}, o), t)
+		taskDuration.WithLabelValues(t.Type()).Observe(time.Since(start).Seconds())
+		if o.value == "" {
+			o.value = "ok"
+			if err != nil {
+				o.value = "error"
+			}
+		}
+		tasksTotal.WithLabelValues(t.Type(), o.value).Inc()
+		return err
+	})
+}
+
+// ObserveCheckUpkeep accounts the duration of a checkUpkeep call
+func ObserveCheckUpkeep(networkName string, d time.Duration) {
+	checkUpkeepDuration.WithLabelValues(networkName).Observe(d.Seconds())
+}
+
+// ObserveInclusion accounts the time from the first send to the receipt of a transaction
+func ObserveInclusion(networkName string, d time.Duration) {
+	inclusionDuration.WithLabelValues(networkName).Observe(d.Seconds())
+}
+
+// ObserveFeeBumps accounts the replacement transactions sent with a higher fee for a task
+func ObserveFeeBumps(networkName string, n int) {
+	feeBumps.WithLabelValues(networkName).Observe(float64(n))
+}
+
+// ObserveGas accounts a receipt of keeper, effectiveGasPrice may be nil
+func ObserveGas(networkName string, keeper common.Address, used uint64, effectiveGasPrice *big.Int) {
+	gasUsed.WithLabelValues(networkName, keeper.Hex()).Add(float64(used))
+	if effectiveGasPrice != nil {
+		spent, _ := new(big.Float).SetInt(new(big.Int).Mul(effectiveGasPrice, new(big.Int).SetUint64(used))).Float64()
+		gasSpent.WithLabelValues(networkName, keeper.Hex()).Add(spent)
+	}
+}
+
+// SetInflightNonces sets the nonces handed out to keeper and not released yet
+func SetInflightNonces(keeper common.Address, n uint64) {
+	inflightNonces.WithLabelValues(keeper.Hex()).Set(float64(n))
+}
+
+// ObserveRPC is an eclient.RPCObserver
+func ObserveRPC(ctx context.Context, call *eclient.RPCCall) {
+	rpcRequests.WithLabelValues(call.NetworkName, call.Endpoint, call.Method).Inc()
+	rpcDuration.WithLabelValues(call.NetworkName, call.Endpoint, call.Method).Observe(call.Duration.Seconds())
+	if call.Err != nil {
+		rpcErrors.WithLabelValues(call.NetworkName, call.Endpoint, call.Method).Inc()
+	}
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hibiken/asynq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	h := Middleware(asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		switch string(t.Payload()) {
+		case "reverted":
+			SetOutcome(ctx, "reverted")
+			return errors.New("reverted")
+		case "error":
+			return errors.New("failed")
+		}
+		return nil
+	}))
+	for _, payload := range []string{"reverted", "error", "ok", "ok"} {
+		_ = h.ProcessTask(context.Background(), asynq.NewTask("metrics_test", []byte(payload)))
+	}
+	assert.Equal(t, float64(1), testutil.ToFloat64(tasksTotal.WithLabelValues("metrics_test", "reverted")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(tasksTotal.WithLabelValues("metrics_test", "error")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(tasksTotal.WithLabelValues("metrics_test", "ok")))
+
+	// without Middleware
+	SetOutcome(context.Background(), "executed")
+}
+
+func TestHandler(t *testing.T) {
+	keeper := common.HexToAddress("0x0000000000000000000000000000000000001234")
+	ObserveGas("metrics_test", keeper, 21000, big.NewInt(2e9))
+	assert.Equal(t, float64(21000*2e9), testutil.ToFloat64(gasSpent.WithLabelValues("metrics_test", keeper.Hex())))
+	ObserveRPC(context.Background(), &eclient.RPCCall{NetworkName: "metrics_test", Endpoint: "https://rpc.example.com", Method: "eth_call", Err: errors.New("timeout")})
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	assert.True(t, strings.Contains(body, `wetask_gas_used_total{keeper="`+keeper.Hex()+`",network="metrics_test"} 21000`), body)
+	assert.Contains(t, body, `wetask_rpc_errors_total{endpoint="https://rpc.example.com",method="eth_call",network="metrics_test"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+}
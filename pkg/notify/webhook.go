@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderTimestamp = "X-Wetask-Timestamp"
+	HeaderSignature = "X-Wetask-Signature"
+
+	signaturePrefix = "sha256="
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Notifier delivers the JSON encoded outcome of a task to callbackURL.
+type Notifier interface {
+	Notify(ctx context.Context, callbackURL string, body []byte) error
+}
+
+// Webhook posts the outcome to the callback URL, signed with HMAC-SHA256 for Verify
+type Webhook struct {
+	Secret []byte
+	Client *http.Client
+	// default 5
+	MaxAttempts int
+	// first retry delay, doubled on every attempt, default 1 second
+	Backoff time.Duration
+}
+
+func NewWebhook(secret []byte) *Webhook {
+	return &Webhook{
+		Secret:      secret,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+	}
+}
+
+func (w *Webhook) Notify(ctx context.Context, callbackURL string, body []byte) error {
+	maxAttempts := w.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	backoff := w.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = w.post(ctx, callbackURL, body)
+		if err == nil || !retry || attempt >= maxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (w *Webhook) post(ctx context.Context, callbackURL string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(w.Secret, timestamp, body))
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("callback %s responded %s", callbackURL, resp.Status)
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of a notification, rejecting timestamps older than tolerance
+func Verify(secret []byte, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp := header.Get(HeaderTimestamp)
+	if tolerance > 0 {
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: bad timestamp %q", ErrInvalidSignature, timestamp)
+		}
+		if d := time.Since(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+			return fmt.Errorf("%w: timestamp %s out of tolerance", ErrInvalidSignature, timestamp)
+		}
+	}
+	if !hmac.Equal([]byte(header.Get(HeaderSignature)), []byte(Sign(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook_Notify(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"outcome":"executed"}`)
+
+	t.Run("signed and retried", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, _ := io.ReadAll(r.Body)
+			assert.Equal(t, body, got)
+			assert.NoError(t, Verify(secret, r.Header, got, time.Minute))
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer srv.Close()
+
+		wh := NewWebhook(secret)
+		wh.Backoff = time.Millisecond
+		assert.NoError(t, wh.Notify(context.Background(), srv.URL, body))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("client error is not retried", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer srv.Close()
+
+		wh := NewWebhook(secret)
+		wh.Backoff = time.Millisecond
+		assert.Error(t, wh.Notify(context.Background(), srv.URL, body))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		wh := NewWebhook(secret)
+		wh.MaxAttempts = 2
+		wh.Backoff = time.Millisecond
+		assert.Error(t, wh.Notify(context.Background(), srv.URL, body))
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+}
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte("{}")
+	header := http.Header{}
+	header.Set(HeaderTimestamp, "1700000000")
+	header.Set(HeaderSignature, Sign(secret, "1700000000", body))
+
+	assert.NoError(t, Verify(secret, header, body, 0))
+	assert.ErrorIs(t, Verify(secret, header, body, time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify([]byte("other"), header, body, 0), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(secret, header, []byte("{ }"), 0), ErrInvalidSignature)
+}
@@ -3,6 +3,8 @@ package pool
 import (
 	"context"
 	"errors"
+	"log/slog"
+	"time"
 
 	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
 	"github.com/ethereum/go-ethereum/accounts"
@@ -74,10 +76,43 @@ func GetSignedTransactOpts(ctx context.Context, networkName string, keeper commo
 	if err != nil {
 		return nil, err
 	}
+	policy, hasPolicy := getGasPolicy(ctx, networkName)
 	return &bind.TransactOpts{
 		From: account.Address,
 		Signer: func(a common.Address, t *types.Transaction) (*types.Transaction, error) {
-			return wallet.SignTx(account, t, chainId)
+			if hasPolicy {
+				if err := policy.check(account.Address, t, time.Now()); err != nil {
+					return nil, err
+				}
+			}
+			signed, err := wallet.SignTx(account, t, chainId)
+			if err != nil && hasPolicy {
+				policy.ledger.release(account.Address, t.Nonce())
+			}
+			return signed, err
 		},
 	}, nil
 }
+
+const loggerKey contextKey = "logger"
+
+// WithLogger logs the handling of the tasks with logger, nothing is logged by default
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+	return discard
+}
+
+var discard = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
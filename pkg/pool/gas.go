@@ -0,0 +1,148 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	ErrGasCapExceeded = errors.New("gas fee cap exceeded")
+	ErrBudgetExceeded = errors.New("spend budget exceeded")
+)
+
+const defaultGasPolicyRetryIn = time.Minute
+
+type GasPolicy struct {
+	// hard cap on the max fee per gas of every signed transaction
+	MaxFeePerGas *big.Int
+	// per keeper spend within the last hour / day, in wei
+	HourlyBudget *big.Int
+	DailyBudget  *big.Int
+	// delay of the tasks deferred by the policy, default 1 minute
+	RetryIn time.Duration
+}
+
+type gasPolicyKey struct {
+	networkName string
+}
+
+type gasPolicy struct {
+	GasPolicy
+	ledger *spendLedger
+}
+
+// WithGasPolicy enforces policy on the transactions signed for networkName, install it once in the base context
+func WithGasPolicy(ctx context.Context, networkName string, policy GasPolicy) context.Context {
+	if policy.RetryIn <= 0 {
+		policy.RetryIn = defaultGasPolicyRetryIn
+	}
+	return context.WithValue(ctx, gasPolicyKey{networkName}, &gasPolicy{
+		GasPolicy: policy,
+		ledger:    &spendLedger{spends: make(map[common.Address][]spend)},
+	})
+}
+
+func getGasPolicy(ctx context.Context, networkName string) (*gasPolicy, bool) {
+	policy, ok := ctx.Value(gasPolicyKey{networkName}).(*gasPolicy)
+	return policy, ok
+}
+
+func (p *gasPolicy) check(keeper common.Address, tx *types.Transaction, now time.Time) error {
+	if p.MaxFeePerGas != nil && tx.GasFeeCap().Cmp(p.MaxFeePerGas) > 0 {
+		return tasks.Defer(fmt.Errorf("%w: %s > %s", ErrGasCapExceeded, tx.GasFeeCap(), p.MaxFeePerGas), p.RetryIn)
+	}
+	if p.HourlyBudget == nil && p.DailyBudget == nil {
+		return nil
+	}
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas()), tx.GasFeeCap())
+	cost.Add(cost, tx.Value())
+	return p.ledger.reserve(keeper, tx.Nonce(), cost, now, func(hourly, daily *big.Int) error {
+		if p.HourlyBudget != nil && hourly.Cmp(p.HourlyBudget) > 0 {
+			return tasks.Defer(fmt.Errorf("%w: hourly spend %s > %s", ErrBudgetExceeded, hourly, p.HourlyBudget), p.RetryIn)
+		}
+		if p.DailyBudget != nil && daily.Cmp(p.DailyBudget) > 0 {
+			return tasks.Defer(fmt.Errorf("%w: daily spend %s > %s", ErrBudgetExceeded, daily, p.DailyBudget), p.RetryIn)
+		}
+		return nil
+	})
+}
+
+// ReleaseSpend rolls back the spend accounted for tx, once it failed to be sent
+func ReleaseSpend(ctx context.Context, networkName string, keeper common.Address, tx *types.Transaction) {
+	if p, ok := getGasPolicy(ctx, networkName); ok {
+		p.ledger.release(keeper, tx.Nonce())
+	}
+}
+
+type spend struct {
+	nonce uint64
+	at    time.Time
+	cost  *big.Int
+	// the spend of the transaction replaced, restored by release
+	replaced *spend
+}
+
+type spendLedger struct {
+	mu     sync.Mutex
+	spends map[common.Address][]spend
+}
+
+// reserve records cost for the nonce of keeper if allow accepts the resulting hourly and daily spends
+func (l *spendLedger) reserve(keeper common.Address, nonce uint64, cost *big.Int, now time.Time, allow func(hourly, daily *big.Int) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var (
+		kept     []spend
+		at       = now
+		replaced *spend
+		hourly   = new(big.Int).Set(cost)
+		daily    = new(big.Int).Set(cost)
+	)
+	for _, s := range l.spends[keeper] {
+		if now.Sub(s.at) >= 24*time.Hour {
+			continue
+		}
+		if s.nonce == nonce {
+			at, replaced = s.at, &s
+			continue
+		}
+		kept = append(kept, s)
+		daily.Add(daily, s.cost)
+		if now.Sub(s.at) < time.Hour {
+			hourly.Add(hourly, s.cost)
+		}
+	}
+	if err := allow(hourly, daily); err != nil {
+		return err
+	}
+	l.spends[keeper] = append(kept, spend{nonce: nonce, at: at, cost: cost, replaced: replaced})
+	return nil
+}
+
+// release removes the spend of the nonce of keeper, restoring the spend it replaced
+func (l *spendLedger) release(keeper common.Address, nonce uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	spends := l.spends[keeper]
+	for i, s := range spends {
+		if s.nonce != nonce {
+			continue
+		}
+		if s.replaced != nil {
+			spends[i] = *s.replaced
+		} else {
+			l.spends[keeper] = append(spends[:i], spends[i+1:]...)
+		}
+		return
+	}
+}
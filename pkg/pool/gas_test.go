@@ -0,0 +1,85 @@
+package pool
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTx(nonce uint64, gas uint64, gasFeeCap int64) *types.Transaction {
+	return types.NewTx(&types.DynamicFeeTx{
+		Nonce:     nonce,
+		Gas:       gas,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(gasFeeCap),
+	})
+}
+
+func TestGasPolicy(t *testing.T) {
+	keeper := common.HexToAddress("0x1234")
+	now := time.Now()
+
+	t.Run("max fee per gas", func(t *testing.T) {
+		ctx := WithGasPolicy(context.Background(), "sepolia", GasPolicy{MaxFeePerGas: big.NewInt(100)})
+		policy, ok := getGasPolicy(ctx, "sepolia")
+		assert.True(t, ok)
+		assert.NoError(t, policy.check(keeper, newTx(0, 21000, 100), now))
+
+		err := policy.check(keeper, newTx(0, 21000, 101), now)
+		assert.ErrorIs(t, err, ErrGasCapExceeded)
+		assert.Equal(t, defaultGasPolicyRetryIn, tasks.RetryDelay(0, err, nil))
+
+		_, ok = getGasPolicy(ctx, "mainnet")
+		assert.False(t, ok)
+	})
+
+	t.Run("hourly budget", func(t *testing.T) {
+		ctx := WithGasPolicy(context.Background(), "sepolia", GasPolicy{HourlyBudget: big.NewInt(1000), RetryIn: time.Second})
+		policy, _ := getGasPolicy(ctx, "sepolia")
+		assert.NoError(t, policy.check(keeper, newTx(0, 10, 60), now))
+		// replacement of nonce 0 only accounts the new cost
+		assert.NoError(t, policy.check(keeper, newTx(0, 10, 66), now))
+		assert.NoError(t, policy.check(keeper, newTx(1, 10, 34), now))
+
+		err := policy.check(keeper, newTx(2, 10, 1), now)
+		assert.ErrorIs(t, err, ErrBudgetExceeded)
+		assert.Equal(t, time.Second, tasks.RetryDelay(0, err, nil))
+
+		// other keepers have their own budget
+		assert.NoError(t, policy.check(common.HexToAddress("0x5678"), newTx(2, 10, 1), now))
+		// spends leave the window
+		assert.NoError(t, policy.check(keeper, newTx(2, 10, 1), now.Add(time.Hour)))
+	})
+
+	t.Run("daily budget", func(t *testing.T) {
+		ctx := WithGasPolicy(context.Background(), "sepolia", GasPolicy{DailyBudget: big.NewInt(1000)})
+		policy, _ := getGasPolicy(ctx, "sepolia")
+		assert.NoError(t, policy.check(keeper, newTx(0, 10, 100), now))
+		assert.ErrorIs(t, policy.check(keeper, newTx(1, 10, 1), now.Add(2*time.Hour)), ErrBudgetExceeded)
+		assert.NoError(t, policy.check(keeper, newTx(1, 10, 1), now.Add(24*time.Hour)))
+	})
+
+	t.Run("release", func(t *testing.T) {
+		ctx := WithGasPolicy(context.Background(), "sepolia", GasPolicy{HourlyBudget: big.NewInt(1000)})
+		policy, _ := getGasPolicy(ctx, "sepolia")
+		assert.NoError(t, policy.check(keeper, newTx(0, 10, 60), now))
+		assert.NoError(t, policy.check(keeper, newTx(1, 10, 40), now))
+		// the transaction of nonce 1 was not sent
+		ReleaseSpend(ctx, "sepolia", keeper, newTx(1, 10, 40))
+		assert.NoError(t, policy.check(keeper, newTx(2, 10, 40), now))
+
+		// the replacement of nonce 0 was not sent, the cost of the replaced transaction is kept
+		assert.NoError(t, policy.check(keeper, newTx(0, 10, 20), now))
+		ReleaseSpend(ctx, "sepolia", keeper, newTx(0, 10, 20))
+		assert.ErrorIs(t, policy.check(keeper, newTx(3, 10, 1), now), ErrBudgetExceeded)
+
+		// without policy
+		ReleaseSpend(context.Background(), "sepolia", keeper, newTx(0, 10, 60))
+	})
+}
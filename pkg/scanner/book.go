@@ -0,0 +1,99 @@
+package scanner
+
+import (
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// OpenOrder is an order of the book
+type OpenOrder struct {
+	Order order.Order
+	// the creation log
+	Topics []common.Hash
+	Data   []byte
+	// the block of the creation log
+	CreatedBlock uint64
+	// the block of the closing log, the order is kept until it can't be reorged
+	ClosedBlock uint64
+}
+
+// State is the checkpoint of a scanner
+type State struct {
+	// the last scanned block, the reorgs are detected by its hash
+	Block uint64
+	Hash  common.Hash
+	// in the order of their creation
+	Orders []*OpenOrder
+}
+
+// book indexes the orders of a state by their key
+type book struct {
+	state *State
+	index map[string]*OpenOrder
+}
+
+func newBook(state *State) *book {
+	b := &book{state: state, index: make(map[string]*OpenOrder, len(state.Orders))}
+	for _, o := range state.Orders {
+		b.index[o.Order.Key()] = o
+	}
+	return b
+}
+
+// apply adds the order created by e, or closes the order closed by e, at block
+func (b *book) apply(e *Event, topics []common.Hash, data []byte, block uint64) {
+	key := e.Order.Key()
+	if !e.Closed {
+		if _, ok := b.index[key]; ok {
+			return
+		}
+		o := &OpenOrder{Order: e.Order, Topics: topics, Data: data, CreatedBlock: block}
+		b.state.Orders = append(b.state.Orders, o)
+		b.index[key] = o
+		return
+	}
+	if o, ok := b.index[key]; ok && o.ClosedBlock == 0 {
+		o.ClosedBlock = block
+	}
+}
+
+// rewind forgets the logs after block
+func (b *book) rewind(block uint64) {
+	b.filter(func(o *OpenOrder) bool {
+		if o.ClosedBlock > block {
+			o.ClosedBlock = 0
+		}
+		return o.CreatedBlock <= block
+	})
+}
+
+// prune drops the orders closed at block or before
+func (b *book) prune(block uint64) {
+	b.filter(func(o *OpenOrder) bool {
+		return o.ClosedBlock == 0 || o.ClosedBlock > block
+	})
+}
+
+func (b *book) filter(keep func(o *OpenOrder) bool) {
+	orders := b.state.Orders[:0]
+	for _, o := range b.state.Orders {
+		if keep(o) {
+			orders = append(orders, o)
+		} else {
+			delete(b.index, o.Order.Key())
+		}
+	}
+	clear(b.state.Orders[len(orders):])
+	b.state.Orders = orders
+}
+
+// open are the orders not closed
+func (b *book) open() []*OpenOrder {
+	var open []*OpenOrder
+	for _, o := range b.state.Orders {
+		if o.ClosedBlock == 0 {
+			open = append(open, o)
+		}
+	}
+	return open
+}
@@ -0,0 +1,52 @@
+package scanner
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBook(t *testing.T) {
+	event := func(index int64, closed bool) *Event {
+		return &Event{Order: order.Order{Account: account, Index: big.NewInt(index), OrderType: big.NewInt(0), ExecuteFee: big.NewInt(0)}, Closed: closed}
+	}
+	b := newBook(new(State))
+	b.apply(event(1, false), nil, nil, 10)
+	b.apply(event(2, false), nil, nil, 20)
+	b.apply(event(1, true), nil, nil, 30)
+	// a closed order is not created again
+	b.apply(event(1, false), nil, nil, 31)
+	assert.Len(t, b.state.Orders, 2)
+	assert.Len(t, b.open(), 1)
+
+	// the close is reorged
+	b.rewind(25)
+	assert.Len(t, b.open(), 2)
+	b.rewind(15)
+	assert.Len(t, b.state.Orders, 1)
+
+	b.apply(event(1, true), nil, nil, 16)
+	b.prune(15)
+	assert.Len(t, b.state.Orders, 1)
+	b.prune(16)
+	assert.Empty(t, b.state.Orders)
+	assert.Empty(t, b.index)
+}
+
+func TestMemoryCheckpoint(t *testing.T) {
+	c := NewMemoryCheckpoint()
+	ctx := context.Background()
+	state, err := c.Load(ctx, "k")
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+
+	state = &State{Block: 1, Orders: []*OpenOrder{{CreatedBlock: 1}}}
+	assert.NoError(t, c.Save(ctx, "k", state))
+	state.Orders[0].ClosedBlock = 2
+	loaded, err := c.Load(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), loaded.Orders[0].ClosedBlock)
+}
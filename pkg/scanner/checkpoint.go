@@ -0,0 +1,175 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/redis/go-redis/v9"
+	"github.com/tinkler/moonmist/pkg/jsonz/cjson"
+)
+
+// Checkpoint persists the state of the scanners, by key
+type Checkpoint interface {
+	// Load returns nil without error when key has no state
+	Load(ctx context.Context, key string) (*State, error)
+	Save(ctx context.Context, key string, state *State) error
+}
+
+func CheckpointKeyOf(networkName string, automationCompatibleAddress common.Address) string {
+	return fmt.Sprintf("%s:%s", networkName, automationCompatibleAddress.Hex())
+}
+
+type MemoryCheckpoint struct {
+	states sync.Map
+}
+
+func NewMemoryCheckpoint() *MemoryCheckpoint {
+	return &MemoryCheckpoint{}
+}
+
+func (c *MemoryCheckpoint) Load(ctx context.Context, key string) (*State, error) {
+	v, ok := c.states.Load(key)
+	if !ok {
+		return nil, nil
+	}
+	return copyState(v.(*State)), nil
+}
+
+func (c *MemoryCheckpoint) Save(ctx context.Context, key string, state *State) error {
+	c.states.Store(key, copyState(state))
+	return nil
+}
+
+func copyState(state *State) *State {
+	copied := *state
+	copied.Orders = make([]*OpenOrder, len(state.Orders))
+	for i, o := range state.Orders {
+		v := *o
+		copied.Orders[i] = &v
+	}
+	return &copied
+}
+
+// RedisCheckpoint keeps the states in Redis hashes, one field per order
+type RedisCheckpoint struct {
+	client redis.UniversalClient
+	prefix string
+	mu     sync.Mutex
+	// the fields saved last, by key
+	saved map[string]map[string]string
+}
+
+const (
+	blockField  = "block"
+	orderPrefix = "order:"
+)
+
+type blockState struct {
+	Block uint64
+	Hash  common.Hash
+}
+
+func NewRedisCheckpoint(client redis.UniversalClient, prefix string) *RedisCheckpoint {
+	if prefix == "" {
+		prefix = "wetask:scanner:"
+	}
+	return &RedisCheckpoint{client: client, prefix: prefix, saved: make(map[string]map[string]string)}
+}
+
+func (c *RedisCheckpoint) Load(ctx context.Context, key string) (*State, error) {
+	fields, err := c.client.HGetAll(ctx, c.prefix+key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	var block blockState
+	if err := cjson.Unmarshal([]byte(fields[blockField]), &block); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", blockField, err)
+	}
+	state := &State{Block: block.Block, Hash: block.Hash}
+	for field, value := range fields {
+		if !strings.HasPrefix(field, orderPrefix) {
+			continue
+		}
+		o := new(OpenOrder)
+		if err := cjson.Unmarshal([]byte(value), o); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", field, err)
+		}
+		state.Orders = append(state.Orders, o)
+	}
+	// the hash forgets the order of the logs of a block
+	sort.SliceStable(state.Orders, func(i, j int) bool {
+		a, b := state.Orders[i], state.Orders[j]
+		if a.CreatedBlock != b.CreatedBlock {
+			return a.CreatedBlock < b.CreatedBlock
+		}
+		return a.Order.Key() < b.Order.Key()
+	})
+	c.mu.Lock()
+	c.saved[key] = fields
+	c.mu.Unlock()
+	return state, nil
+}
+
+func (c *RedisCheckpoint) Save(ctx context.Context, key string, state *State) error {
+	fields := make(map[string]string, len(state.Orders)+1)
+	data, err := cjson.Marshal(blockState{Block: state.Block, Hash: state.Hash})
+	if err != nil {
+		return err
+	}
+	fields[blockField] = string(data)
+	for _, o := range state.Orders {
+		data, err := cjson.Marshal(o)
+		if err != nil {
+			return err
+		}
+		fields[orderPrefix+o.Order.Key()] = string(data)
+	}
+	c.mu.Lock()
+	saved := c.saved[key]
+	c.mu.Unlock()
+	var (
+		changed []interface{}
+		removed []string
+	)
+	for field, value := range fields {
+		if v, ok := saved[field]; !ok || v != value {
+			changed = append(changed, field, value)
+		}
+	}
+	for field := range saved {
+		if _, ok := fields[field]; !ok {
+			removed = append(removed, field)
+		}
+	}
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if saved == nil {
+			// the fields of an unknown state are all replaced
+			pipe.Del(ctx, c.prefix+key)
+		}
+		if len(changed) > 0 {
+			pipe.HSet(ctx, c.prefix+key, changed...)
+		}
+		if len(removed) > 0 {
+			pipe.HDel(ctx, c.prefix+key, removed...)
+		}
+		return nil
+	})
+	if err != nil {
+		// written in full next time
+		c.mu.Lock()
+		delete(c.saved, key)
+		c.mu.Unlock()
+		return err
+	}
+	c.mu.Lock()
+	c.saved[key] = fields
+	c.mu.Unlock()
+	return nil
+}
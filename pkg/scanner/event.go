@@ -0,0 +1,177 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// OrderEventsABI are the events decoded by DefaultEventDecoder
+const OrderEventsABI = `[{"anonymous":false,"inputs":[` +
+	`{"indexed":true,"internalType":"address","name":"account","type":"address"},` +
+	`{"indexed":true,"internalType":"uint256","name":"index","type":"uint256"},` +
+	`{"indexed":false,"internalType":"uint256","name":"orderType","type":"uint256"},` +
+	`{"indexed":false,"internalType":"uint256","name":"executeFee","type":"uint256"}` +
+	`],"name":"OrderCreated","type":"event"},{"anonymous":false,"inputs":[` +
+	`{"indexed":true,"internalType":"address","name":"account","type":"address"},` +
+	`{"indexed":true,"internalType":"uint256","name":"index","type":"uint256"}` +
+	`],"name":"OrderCancelled","type":"event"},{"anonymous":false,"inputs":[` +
+	`{"indexed":true,"internalType":"address","name":"account","type":"address"},` +
+	`{"indexed":true,"internalType":"uint256","name":"index","type":"uint256"},` +
+	`{"indexed":false,"internalType":"uint256","name":"amountIn","type":"uint256"},` +
+	`{"indexed":false,"internalType":"uint256","name":"amountOut","type":"uint256"}` +
+	`],"name":"OrderExecuted","type":"event"}]`
+
+var ErrUnknownEvent = errors.New("unknown event")
+
+// Event is an order created or closed by a log
+type Event struct {
+	Order  order.Order
+	Closed bool
+	// every argument of the log
+	Args map[string]interface{}
+}
+
+// EventDecoder decodes the events creating and closing the orders
+type EventDecoder struct {
+	created abi.Event
+	closed  []abi.Event
+}
+
+var defaultEventDecoder *EventDecoder
+
+func init() {
+	var err error
+	defaultEventDecoder, err = NewEventDecoder(OrderEventsABI, "OrderCreated", "OrderCancelled", "OrderExecuted")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// DefaultEventDecoder closes the orders cancelled or executed, partially too: the TWAP tasks carry the slices left.
+func DefaultEventDecoder() *EventDecoder {
+	return defaultEventDecoder
+}
+
+// NewEventDecoder decodes the events created and closed of the JSON ABI eventsABI
+func NewEventDecoder(eventsABI string, created string, closed ...string) (*EventDecoder, error) {
+	parsed, err := abi.JSON(strings.NewReader(eventsABI))
+	if err != nil {
+		return nil, err
+	}
+	lookup := func(name string, args ...string) (abi.Event, error) {
+		event, ok := parsed.Events[name]
+		if !ok {
+			return event, fmt.Errorf("event %s is not in the abi", name)
+		}
+		for _, arg := range args {
+			found := false
+			for _, input := range event.Inputs {
+				found = found || input.Name == arg
+			}
+			if !found {
+				return event, fmt.Errorf("event %s has no %s argument", name, arg)
+			}
+		}
+		return event, nil
+	}
+	d := new(EventDecoder)
+	if d.created, err = lookup(created, "account", "index", "orderType"); err != nil {
+		return nil, err
+	}
+	if len(closed) == 0 {
+		return nil, errors.New("at least one closing event is required")
+	}
+	for _, name := range closed {
+		event, err := lookup(name, "account", "index")
+		if err != nil {
+			return nil, err
+		}
+		d.closed = append(d.closed, event)
+	}
+	return d, nil
+}
+
+// Topics are the event ids, the first topic of the logs to filter
+func (d *EventDecoder) Topics() []common.Hash {
+	topics := []common.Hash{d.created.ID}
+	for _, event := range d.closed {
+		topics = append(topics, event.ID)
+	}
+	return topics
+}
+
+// Decode returns the order created or closed by log, ErrUnknownEvent for the other logs
+func (d *EventDecoder) Decode(log *types.Log) (*Event, error) {
+	if len(log.Topics) == 0 {
+		return nil, ErrUnknownEvent
+	}
+	event, closed := d.created, false
+	if log.Topics[0] != event.ID {
+		found := false
+		for _, e := range d.closed {
+			if log.Topics[0] == e.ID {
+				event, closed, found = e, true, true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrUnknownEvent
+		}
+	}
+	args, err := unpack(event, log)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", event.Name, err)
+	}
+	account, ok := args["account"].(common.Address)
+	if !ok {
+		return nil, fmt.Errorf("account of event %s is not an address", event.Name)
+	}
+	index, ok := args["index"].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("index of event %s is not an uint", event.Name)
+	}
+	e := &Event{Order: order.Order{Account: account, Index: index}, Closed: closed, Args: args}
+	if closed {
+		return e, nil
+	}
+	if e.Order.OrderType, ok = args["orderType"].(*big.Int); !ok {
+		return nil, fmt.Errorf("orderType of event %s is not an uint", event.Name)
+	}
+	e.Order.ExecuteFee, ok = args["executeFee"].(*big.Int)
+	if !ok {
+		e.Order.ExecuteFee = big.NewInt(0)
+	}
+	return e, nil
+}
+
+// Args decodes the arguments of the log creating o
+func (d *EventDecoder) Args(o *OpenOrder) (map[string]interface{}, error) {
+	return unpack(d.created, &types.Log{Topics: o.Topics, Data: o.Data})
+}
+
+func unpack(event abi.Event, log *types.Log) (map[string]interface{}, error) {
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	values := make(map[string]interface{})
+	if err := event.Inputs.UnpackIntoMap(values, log.Data); err != nil {
+		return nil, err
+	}
+	if len(log.Topics) == 0 {
+		return nil, ErrUnknownEvent
+	}
+	if err := abi.ParseTopicsIntoMap(values, indexed, log.Topics[1:]); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
@@ -0,0 +1,51 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventDecoder_Decode(t *testing.T) {
+	d := DefaultEventDecoder()
+	assert.Len(t, d.Topics(), 3)
+
+	log := createdLog(3, 1)
+	e, err := d.Decode(&log)
+	assert.NoError(t, err)
+	assert.False(t, e.Closed)
+	assert.Equal(t, account, e.Order.Account)
+	assert.Equal(t, "1", e.Order.Index.String())
+	assert.Equal(t, "0", e.Order.OrderType.String())
+	assert.Equal(t, "7", e.Order.ExecuteFee.String())
+
+	args, err := d.Args(&OpenOrder{Topics: log.Topics, Data: log.Data})
+	assert.NoError(t, err)
+	assert.Equal(t, account, args["account"])
+
+	log = cancelledLog(4, 1)
+	e, err = d.Decode(&log)
+	assert.NoError(t, err)
+	assert.True(t, e.Closed)
+	assert.Equal(t, orderKey(1), e.Order.Key())
+
+	log = executedLog(5, 2)
+	e, err = d.Decode(&log)
+	assert.NoError(t, err)
+	assert.True(t, e.Closed)
+	assert.Equal(t, orderKey(2), e.Order.Key())
+
+	_, err = d.Decode(&types.Log{Topics: log.Topics[1:]})
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+}
+
+func TestNewEventDecoder(t *testing.T) {
+	_, err := NewEventDecoder(OrderEventsABI, "OrderPlaced", "OrderCancelled")
+	assert.Error(t, err)
+	_, err = NewEventDecoder(OrderEventsABI, "OrderCreated")
+	assert.Error(t, err)
+	// no orderType
+	_, err = NewEventDecoder(OrderEventsABI, "OrderCancelled", "OrderCancelled")
+	assert.Error(t, err)
+}
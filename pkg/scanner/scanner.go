@@ -0,0 +1,417 @@
+// Package scanner discovers the orders of a limit order contract from its logs and enqueues their tasks.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/com"
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/pool"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/WEPublicGoods/wetask/pkg/tasks/order/limit_keeper"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/hibiken/asynq"
+)
+
+// DefaultMulticall3 is the address of Multicall3 on most chains
+var DefaultMulticall3 = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+// QuoteFunc returns the execution of o, nil when it is not worth executing
+type QuoteFunc func(ctx context.Context, o *OpenOrder, args map[string]interface{}) (*order.LimitOrderExecuteInput, error)
+
+type Config struct {
+	Client                      eclient.Ethclient
+	AutomationCompatibleAddress common.Address
+	Keeper                      common.Address
+	Enqueuer                    tasks.Enqueuer
+	Checkpoint                  Checkpoint
+	// the first block scanned without checkpoint, the head of the chain when 0
+	FromBlock uint64
+	// the blocks behind the head left unscanned
+	Confirmations uint64
+	// the blocks scanned again when the last scanned block is reorged, 64 by default
+	ReorgDepth uint64
+	// the largest block range of eth_getLogs, 2000 by default, halved while the RPC rejects it
+	MaxBlockRange uint64
+	// the checkUpkeep calls batched in one aggregate3 call, 100 by default
+	BatchSize int
+	// DefaultMulticall3 when zero
+	Multicall common.Address
+	// call checkUpkeep once per order from the Keeper, for the contracts reading msg.sender
+	DirectCheck bool
+	// between the scans, 15 seconds by default
+	Interval time.Duration
+	// the queue of the enqueued tasks, the default queue when empty
+	Queue string
+	// DefaultEventDecoder when nil
+	Events *EventDecoder
+	// the orders are only checked for their cancel without quote: ACT_LIMIT_ORDER is never enqueued then
+	Quote QuoteFunc
+}
+
+// Scanner follows the orders of an automation compatible contract and enqueues the callable ones
+type Scanner struct {
+	cfg        Config
+	key        string
+	blockRange uint64
+	book       *book
+}
+
+func New(cfg Config) (*Scanner, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("client is required")
+	}
+	if cfg.AutomationCompatibleAddress == (common.Address{}) {
+		return nil, errors.New("automation compatible address is required")
+	}
+	if cfg.Keeper == (common.Address{}) {
+		return nil, errors.New("keeper is required")
+	}
+	if cfg.Enqueuer == nil {
+		return nil, errors.New("enqueuer is required")
+	}
+	if cfg.Checkpoint == nil {
+		return nil, errors.New("checkpoint is required")
+	}
+	if cfg.ReorgDepth == 0 {
+		cfg.ReorgDepth = 64
+	}
+	if cfg.MaxBlockRange == 0 {
+		cfg.MaxBlockRange = 2000
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Multicall == (common.Address{}) {
+		cfg.Multicall = DefaultMulticall3
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Second
+	}
+	if cfg.Events == nil {
+		cfg.Events = DefaultEventDecoder()
+	}
+	return &Scanner{
+		cfg:        cfg,
+		key:        CheckpointKeyOf(cfg.Client.Network(), cfg.AutomationCompatibleAddress),
+		blockRange: cfg.MaxBlockRange,
+	}, nil
+}
+
+// Run scans every interval until ctx is done, the failed scans are tried again
+func (s *Scanner) Run(ctx context.Context) {
+	logger := pool.Logger(ctx).With(slog.String("network", s.cfg.Client.Network()), slog.String("contract", s.cfg.AutomationCompatibleAddress.Hex()))
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Scan(pool.WithLogger(ctx, logger)); err != nil && ctx.Err() == nil {
+			logger.Error("scan failed", slog.String("error", eclient.RedactURLs(err.Error())))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan follows the logs up to the confirmed head, then enqueues the tasks of the callable orders
+func (s *Scanner) Scan(ctx context.Context) error {
+	backend, err := s.cfg.Client.GetClient(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.follow(ctx, backend); err != nil {
+		return err
+	}
+	if s.book == nil {
+		// the chain is shorter than the confirmations
+		return nil
+	}
+	return s.check(ctx, backend)
+}
+
+func header(ctx context.Context, backend bind.ContractBackend, number uint64) (*types.Header, error) {
+	h, err := backend.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return nil, fmt.Errorf("get block %d: %w", number, err)
+	}
+	return h, nil
+}
+
+// load restores the book from the checkpoint, or starts it at FromBlock
+func (s *Scanner) load(ctx context.Context, backend bind.ContractBackend, safe uint64) error {
+	if s.book != nil {
+		return nil
+	}
+	state, err := s.cfg.Checkpoint.Load(ctx, s.key)
+	if err != nil {
+		return fmt.Errorf("load checkpoint: %w", err)
+	}
+	if state == nil {
+		state = new(State)
+		if s.cfg.FromBlock == 0 {
+			h, err := header(ctx, backend, safe)
+			if err != nil {
+				return err
+			}
+			state.Block, state.Hash = safe, h.Hash()
+		} else {
+			// the hash of a block never scanned is not checked
+			state.Block = s.cfg.FromBlock - 1
+		}
+	}
+	s.book = newBook(state)
+	return nil
+}
+
+// follow applies the logs up to the head minus the confirmations, the checkpoint is saved after every range
+func (s *Scanner) follow(ctx context.Context, backend bind.ContractBackend) error {
+	logger := pool.Logger(ctx)
+	head, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("get the latest block: %w", err)
+	}
+	if head.Number.Uint64() < s.cfg.Confirmations {
+		return nil
+	}
+	safe := head.Number.Uint64() - s.cfg.Confirmations
+	if err := s.load(ctx, backend, safe); err != nil {
+		return err
+	}
+	state := s.book.state
+	if state.Hash != (common.Hash{}) {
+		h, err := header(ctx, backend, state.Block)
+		if err != nil {
+			return err
+		}
+		if h.Hash() != state.Hash {
+			block := uint64(0)
+			if state.Block > s.cfg.ReorgDepth {
+				block = state.Block - s.cfg.ReorgDepth
+			}
+			logger.Warn("reorg detected", slog.Uint64("block", state.Block), slog.Uint64("rewindTo", block))
+			if h, err = header(ctx, backend, block); err != nil {
+				return err
+			}
+			s.book.rewind(block)
+			state.Block, state.Hash = block, h.Hash()
+			if err := s.cfg.Checkpoint.Save(ctx, s.key, state); err != nil {
+				return fmt.Errorf("save checkpoint: %w", err)
+			}
+		}
+	}
+	for state.Block < safe {
+		from := state.Block + 1
+		to := min(from+s.blockRange-1, safe)
+		logs, err := backend.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(to),
+			Addresses: []common.Address{s.cfg.AutomationCompatibleAddress},
+			Topics:    [][]common.Hash{s.cfg.Events.Topics()},
+		})
+		if err != nil {
+			// the RPCs limit the block range or the results of a query
+			if ctx.Err() == nil && to > from {
+				s.blockRange = (to - from + 1) / 2
+				logger.Warn("get logs failed, block range halved", slog.Uint64("from", from), slog.Uint64("to", to), slog.Uint64("blockRange", s.blockRange), slog.String("error", eclient.RedactURLs(err.Error())))
+				continue
+			}
+			return fmt.Errorf("get logs of blocks %d-%d: %w", from, to, err)
+		}
+		// a block reorged since is detected by the hash of the next scan
+		h, err := header(ctx, backend, to)
+		if err != nil {
+			return err
+		}
+		for i := range logs {
+			log := &logs[i]
+			if log.Removed {
+				continue
+			}
+			e, err := s.cfg.Events.Decode(log)
+			if err != nil {
+				logger.Warn("log not decoded", slog.String("txHash", log.TxHash.Hex()), slog.Uint64("logIndex", uint64(log.Index)), slog.String("error", err.Error()))
+				continue
+			}
+			s.book.apply(e, log.Topics, log.Data, log.BlockNumber)
+		}
+		state.Block, state.Hash = to, h.Hash()
+		if to > s.cfg.ReorgDepth {
+			s.book.prune(to - s.cfg.ReorgDepth)
+		}
+		if err := s.cfg.Checkpoint.Save(ctx, s.key, state); err != nil {
+			return fmt.Errorf("save checkpoint: %w", err)
+		}
+		s.blockRange = min(s.blockRange*2, s.cfg.MaxBlockRange)
+	}
+	return nil
+}
+
+// check enqueues the cancel of the expired orders, otherwise their execution when it is callable
+func (s *Scanner) check(ctx context.Context, backend bind.ContractBackend) error {
+	logger := pool.Logger(ctx)
+	network, contract, keeper := s.cfg.Client.Network(), s.cfg.AutomationCompatibleAddress.Hex(), s.cfg.Keeper.Hex()
+	type candidate struct {
+		key  string
+		task *asynq.Task
+	}
+	var (
+		candidates []candidate
+		checkData  [][]byte
+	)
+	add := func(key string, t *asynq.Task, err error) {
+		if err == nil {
+			var d *limit_keeper.Decoded
+			if d, err = limit_keeper.DecodeTask(t); err == nil {
+				candidates, checkData = append(candidates, candidate{key, t}), append(checkData, d.OrderData)
+				return
+			}
+		}
+		logger.Warn("order not checked", slog.String("order", key), slog.String("error", err.Error()))
+	}
+	for _, o := range s.book.open() {
+		key := o.Order.Key()
+		task, err := limit_keeper.NewCancelTask(network, contract, keeper, o.Order)
+		add(key, task, err)
+		if s.cfg.Quote == nil {
+			continue
+		}
+		args, err := s.cfg.Events.Args(o)
+		if err != nil {
+			logger.Warn("order not quoted", slog.String("order", key), slog.String("error", err.Error()))
+			continue
+		}
+		in, err := s.cfg.Quote(ctx, o, args)
+		if err != nil {
+			logger.Warn("order not quoted", slog.String("order", key), slog.String("error", err.Error()))
+			continue
+		}
+		if in != nil {
+			in.Order = o.Order
+			task, err := limit_keeper.NewNormalTask(network, contract, keeper, *in)
+			add(key, task, err)
+		}
+	}
+	callable := make([]bool, 0, len(checkData))
+	for start := 0; start < len(checkData); start += s.cfg.BatchSize {
+		batch, err := s.checkUpkeeps(ctx, backend, checkData[start:min(start+s.cfg.BatchSize, len(checkData))])
+		if err != nil {
+			return err
+		}
+		callable = append(callable, batch...)
+	}
+	var opts []asynq.Option
+	if s.cfg.Queue != "" {
+		opts = append(opts, asynq.Queue(s.cfg.Queue))
+	}
+	cancelled := make(map[string]bool)
+	for i, c := range candidates {
+		if !callable[i] {
+			continue
+		}
+		t, key := c.task, c.key
+		if t.Type() == tasks.ACT_CANCEL_LIMIT_ORDER {
+			cancelled[key] = true
+		} else if cancelled[key] {
+			// an expired order is not executed
+			continue
+		}
+		info, err := limit_keeper.Enqueue(ctx, s.cfg.Enqueuer, t, 0, opts...)
+		if err != nil {
+			// a duplicate is still to run, the finished tasks are replaced
+			if errors.Is(err, tasks.ErrDuplicateTask) {
+				logger.Debug("task already enqueued", slog.String("type", t.Type()), slog.String("order", key))
+				continue
+			}
+			return fmt.Errorf("enqueue %s of %s: %w", t.Type(), key, err)
+		}
+		logger.Info("task enqueued", slog.String("type", t.Type()), slog.String("order", key), slog.String("taskId", info.ID))
+	}
+	return nil
+}
+
+// checkUpkeeps runs the checkUpkeep of every checkData through Multicall3, a reverted one is checked again from the keeper
+func (s *Scanner) checkUpkeeps(ctx context.Context, backend bind.ContractBackend, checkData [][]byte) ([]bool, error) {
+	automation, err := com.AutomationCompatibleMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([][]byte, len(checkData))
+	for i, data := range checkData {
+		if inputs[i], err = automation.Pack("checkUpkeep", data); err != nil {
+			return nil, err
+		}
+	}
+	callable := make([]bool, len(inputs))
+	if s.cfg.DirectCheck {
+		for i, input := range inputs {
+			if callable[i], err = s.checkUpkeep(ctx, backend, automation, input); err != nil {
+				return nil, err
+			}
+		}
+		return callable, nil
+	}
+	calls := make([]com.Multicall3Call3, len(inputs))
+	for i, input := range inputs {
+		calls[i] = com.Multicall3Call3{Target: s.cfg.AutomationCompatibleAddress, AllowFailure: true, CallData: input}
+	}
+	multicall, err := com.NewMulticall3(s.cfg.Multicall, backend)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	if err := (&com.Multicall3Raw{Contract: multicall}).Call(&bind.CallOpts{Context: ctx, From: s.cfg.Keeper}, &out, "aggregate3", calls); err != nil {
+		return nil, fmt.Errorf("aggregate3 checkUpkeep: %w", err)
+	}
+	results := *abi.ConvertType(out[0], new([]com.Multicall3Result)).(*[]com.Multicall3Result)
+	if len(results) != len(calls) {
+		return nil, fmt.Errorf("aggregate3 returned %d results for %d calls", len(results), len(calls))
+	}
+	for i, result := range results {
+		if !result.Success {
+			if callable[i], err = s.checkUpkeep(ctx, backend, automation, inputs[i]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		values, err := automation.Unpack("checkUpkeep", result.ReturnData)
+		if err != nil || len(values) == 0 {
+			continue
+		}
+		callable[i], _ = values[0].(bool)
+	}
+	return callable, nil
+}
+
+// checkUpkeep calls the checkUpkeep input from the keeper, a revert is not callable
+func (s *Scanner) checkUpkeep(ctx context.Context, backend bind.ContractBackend, automation *abi.ABI, input []byte) (bool, error) {
+	contract := s.cfg.AutomationCompatibleAddress
+	data, err := backend.CallContract(ctx, ethereum.CallMsg{From: s.cfg.Keeper, To: &contract, Data: input}, nil)
+	if err != nil {
+		// geth reports a revert with the code 3, the other nodes not always
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == 3 || strings.Contains(err.Error(), "execution reverted") {
+			return false, nil
+		}
+		return false, fmt.Errorf("checkUpkeep: %w", err)
+	}
+	values, err := automation.Unpack("checkUpkeep", data)
+	if err != nil || len(values) == 0 {
+		return false, nil
+	}
+	callable, _ := values[0].(bool)
+	return callable, nil
+}
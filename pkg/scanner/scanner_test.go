@@ -0,0 +1,370 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/com"
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/WEPublicGoods/wetask/pkg/tasks/order/limit_keeper"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	contract = common.HexToAddress("0x000000000000000000000000000000000000c0ff")
+	keeper   = common.HexToAddress("0x0000000000000000000000000000000000001234")
+	account  = common.HexToAddress("0x1111111111111111111111111111111111111111")
+)
+
+// chain serves the logs of contract, the blocks of a fork have their own hashes
+type chain struct {
+	bind.ContractBackend
+	head uint64
+	fork map[uint64]string
+	logs []types.Log
+	// the largest block range of eth_getLogs
+	maxRange uint64
+	queries  [][2]uint64
+	// "<order key>:cancel" or "<order key>:execute"
+	callable map[string]bool
+	checked  int
+	// checkUpkeep reverts unless called by the keeper
+	keeperOnly bool
+}
+
+func (c *chain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	n := c.head
+	if number != nil {
+		n = number.Uint64()
+	}
+	return &types.Header{Number: new(big.Int).SetUint64(n), Extra: []byte(c.fork[n])}, nil
+}
+
+func (c *chain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+	if to-from+1 > c.maxRange {
+		return nil, errors.New("block range too large")
+	}
+	c.queries = append(c.queries, [2]uint64{from, to})
+	var logs []types.Log
+	for _, log := range c.logs {
+		if log.BlockNumber >= from && log.BlockNumber <= to {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+func (c *chain) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	if *msg.To == contract {
+		data, ok, err := c.checkUpkeep(msg.From, msg.Data)
+		if err == nil && !ok {
+			err = errors.New("execution reverted")
+		}
+		return data, err
+	}
+	multicall, _ := com.Multicall3MetaData.GetAbi()
+	aggregate3 := multicall.Methods["aggregate3"]
+	args, err := aggregate3.Inputs.Unpack(msg.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	calls := *abi.ConvertType(args[0], new([]com.Multicall3Call3)).(*[]com.Multicall3Call3)
+	results := make([]com.Multicall3Result, len(calls))
+	for i, call := range calls {
+		data, ok, err := c.checkUpkeep(*msg.To, call.CallData)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = com.Multicall3Result{Success: ok, ReturnData: data}
+	}
+	return aggregate3.Outputs.Pack(results)
+}
+
+// checkUpkeep returns false when the call reverts
+func (c *chain) checkUpkeep(sender common.Address, callData []byte) ([]byte, bool, error) {
+	automation, _ := com.AutomationCompatibleMetaData.GetAbi()
+	c.checked++
+	input, err := automation.Methods["checkUpkeep"].Inputs.Unpack(callData[4:])
+	if err != nil {
+		return nil, false, err
+	}
+	in, isExpired, err := order.DecodeLimitOrderExecuteInput(input[0].([]byte))
+	if err != nil {
+		return nil, false, err
+	}
+	kind := "execute"
+	if isExpired {
+		kind = "cancel"
+	}
+	callable, ok := c.callable[in.Order.Key()+":"+kind]
+	if !ok || c.keeperOnly && sender != keeper {
+		return nil, false, nil
+	}
+	data, _ := automation.Methods["checkUpkeep"].Outputs.Pack(callable, []byte{})
+	return data, true, nil
+}
+
+type chainClient struct {
+	eclient.Ethclient
+	backend *chain
+}
+
+func (c *chainClient) Network() string { return "sepolia" }
+
+func (c *chainClient) GetClient(ctx context.Context) (bind.ContractBackend, error) {
+	return c.backend, nil
+}
+
+type recordEnqueuer struct {
+	ids   map[string]bool
+	tasks []string
+}
+
+func (e *recordEnqueuer) EnqueueContext(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	d, err := limit_keeper.DecodeTask(task)
+	if err != nil {
+		return nil, err
+	}
+	in, isExpired, err := order.DecodeLimitOrderExecuteInput(d.OrderData)
+	if err != nil {
+		return nil, err
+	}
+	id := limit_keeper.TaskID(d.NetworkName, d.AutomationCompatibleAddress, in.Order, isExpired)
+	if e.ids[id] {
+		return nil, asynq.ErrTaskIDConflict
+	}
+	e.ids[id] = true
+	e.tasks = append(e.tasks, task.Type()+":"+in.Order.Index.String())
+	return &asynq.TaskInfo{ID: id, Queue: "low"}, nil
+}
+
+func createdLog(block uint64, index int64) types.Log {
+	data := append(common.LeftPadBytes(big.NewInt(0).Bytes(), 32), common.LeftPadBytes(big.NewInt(7).Bytes(), 32)...)
+	return types.Log{
+		Address: contract,
+		Topics: []common.Hash{
+			crypto.Keccak256Hash([]byte("OrderCreated(address,uint256,uint256,uint256)")),
+			common.BytesToHash(account.Bytes()),
+			common.BigToHash(big.NewInt(index)),
+		},
+		Data:        data,
+		BlockNumber: block,
+	}
+}
+
+func cancelledLog(block uint64, index int64) types.Log {
+	return types.Log{
+		Address: contract,
+		Topics: []common.Hash{
+			crypto.Keccak256Hash([]byte("OrderCancelled(address,uint256)")),
+			common.BytesToHash(account.Bytes()),
+			common.BigToHash(big.NewInt(index)),
+		},
+		BlockNumber: block,
+	}
+}
+
+func executedLog(block uint64, index int64) types.Log {
+	return types.Log{
+		Address: contract,
+		Topics: []common.Hash{
+			crypto.Keccak256Hash([]byte("OrderExecuted(address,uint256,uint256,uint256)")),
+			common.BytesToHash(account.Bytes()),
+			common.BigToHash(big.NewInt(index)),
+		},
+		Data:        append(common.LeftPadBytes(big.NewInt(1000).Bytes(), 32), common.LeftPadBytes(big.NewInt(2000).Bytes(), 32)...),
+		BlockNumber: block,
+	}
+}
+
+func quote(ctx context.Context, o *OpenOrder, args map[string]interface{}) (*order.LimitOrderExecuteInput, error) {
+	tokenIn, tokenOut := common.HexToAddress("0x2222222222222222222222222222222222222222"), common.HexToAddress("0x3333333333333333333333333333333333333333")
+	return &order.LimitOrderExecuteInput{
+		TokenIn:           tokenIn,
+		TokenOut:          tokenOut,
+		RemainingAmountIn: big.NewInt(1000),
+		Routes:            []order.SwapRoute{{TokenIn: tokenIn, TokenOut: tokenOut, AmountIn: big.NewInt(1000), AmountOutMin: big.NewInt(1800)}},
+		AmountIn:          big.NewInt(1000),
+		AmountOutMin:      big.NewInt(1800),
+		AmountOutExpected: big.NewInt(2000),
+	}, nil
+}
+
+func orderKey(index int64) string {
+	return order.Order{Account: account, Index: big.NewInt(index)}.Key()
+}
+
+func TestScanner(t *testing.T) {
+	backend := &chain{
+		head:     30,
+		fork:     map[uint64]string{},
+		maxRange: 5,
+		logs: []types.Log{
+			createdLog(3, 1),
+			createdLog(10, 2),
+			createdLog(12, 3),
+			cancelledLog(14, 3),
+			createdLog(27, 4),
+		},
+		callable: map[string]bool{
+			orderKey(1) + ":cancel":  true,
+			orderKey(1) + ":execute": true,
+			orderKey(2) + ":cancel":  false,
+			orderKey(2) + ":execute": true,
+			orderKey(4) + ":execute": false,
+		},
+	}
+	checkpoint := NewMemoryCheckpoint()
+	enqueuer := &recordEnqueuer{ids: map[string]bool{}}
+	cfg := Config{
+		Client:                      &chainClient{backend: backend},
+		AutomationCompatibleAddress: contract,
+		Keeper:                      keeper,
+		Enqueuer:                    enqueuer,
+		Checkpoint:                  checkpoint,
+		FromBlock:                   1,
+		Confirmations:               2,
+		ReorgDepth:                  10,
+		MaxBlockRange:               16,
+		BatchSize:                   3,
+		Quote:                       quote,
+	}
+	s, err := New(cfg)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, s.Scan(ctx))
+
+	// the ranges rejected by the rpc are split, up to the confirmed head
+	next := uint64(1)
+	for _, q := range backend.queries {
+		assert.Equal(t, next, q[0])
+		assert.LessOrEqual(t, q[1]-q[0]+1, uint64(5))
+		next = q[1] + 1
+	}
+	assert.Equal(t, uint64(29), next)
+
+	// the expired order is cancelled rather than executed, the order 3 is closed
+	assert.Equal(t, []string{tasks.ACT_CANCEL_LIMIT_ORDER + ":1", tasks.ACT_LIMIT_ORDER + ":2"}, enqueuer.tasks)
+	// the reverted cancel of the order 4 is checked again from the keeper
+	assert.Equal(t, 7, backend.checked)
+
+	state, err := checkpoint.Load(ctx, CheckpointKeyOf("sepolia", contract))
+	assert.NoError(t, err)
+	h, _ := backend.HeaderByNumber(ctx, big.NewInt(28))
+	assert.Equal(t, uint64(28), state.Block)
+	assert.Equal(t, h.Hash(), state.Hash)
+	var indexes []string
+	for _, o := range state.Orders {
+		indexes = append(indexes, o.Order.Index.String())
+	}
+	// the tombstone of the order 3 is pruned past the reorg depth
+	assert.Equal(t, []string{"1", "2", "4"}, indexes)
+	assert.Equal(t, "7", state.Orders[0].Order.ExecuteFee.String())
+
+	// the blocks from 25 are reorged, the order 4 is gone
+	for n := uint64(25); n <= 32; n++ {
+		backend.fork[n] = "b"
+	}
+	backend.logs = backend.logs[:4]
+	backend.head, backend.queries, enqueuer.tasks = 32, nil, nil
+	// a restart resumes from the checkpoint
+	s, err = New(cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Scan(ctx))
+	if assert.NotEmpty(t, backend.queries) {
+		assert.Equal(t, uint64(19), backend.queries[0][0])
+		assert.Equal(t, uint64(30), backend.queries[len(backend.queries)-1][1])
+	}
+	assert.Len(t, s.book.state.Orders, 2)
+	// enqueued already
+	assert.Empty(t, enqueuer.tasks)
+}
+
+func TestNew(t *testing.T) {
+	client := &chainClient{backend: &chain{}}
+	for name, cfg := range map[string]Config{
+		"client":     {AutomationCompatibleAddress: contract, Keeper: keeper, Enqueuer: &recordEnqueuer{}, Checkpoint: NewMemoryCheckpoint()},
+		"contract":   {Client: client, Keeper: keeper, Enqueuer: &recordEnqueuer{}, Checkpoint: NewMemoryCheckpoint()},
+		"keeper":     {Client: client, AutomationCompatibleAddress: contract, Enqueuer: &recordEnqueuer{}, Checkpoint: NewMemoryCheckpoint()},
+		"enqueuer":   {Client: client, AutomationCompatibleAddress: contract, Keeper: keeper, Checkpoint: NewMemoryCheckpoint()},
+		"checkpoint": {Client: client, AutomationCompatibleAddress: contract, Keeper: keeper, Enqueuer: &recordEnqueuer{}},
+	} {
+		_, err := New(cfg)
+		assert.Error(t, err, name)
+	}
+	s, err := New(Config{Client: client, AutomationCompatibleAddress: contract, Keeper: keeper, Enqueuer: &recordEnqueuer{}, Checkpoint: NewMemoryCheckpoint()})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultMulticall3, s.cfg.Multicall)
+	assert.Equal(t, fmt.Sprintf("sepolia:%s", contract.Hex()), s.key)
+}
+
+func TestScanner_FromHead(t *testing.T) {
+	backend := &chain{head: 100, fork: map[uint64]string{}, maxRange: 2000, logs: []types.Log{createdLog(50, 1)}}
+	s, err := New(Config{Client: &chainClient{backend: backend}, AutomationCompatibleAddress: contract, Keeper: keeper, Enqueuer: &recordEnqueuer{ids: map[string]bool{}}, Checkpoint: NewMemoryCheckpoint()})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Scan(context.Background()))
+	assert.Empty(t, backend.queries)
+	assert.Equal(t, uint64(100), s.book.state.Block)
+
+	backend.head = 103
+	assert.NoError(t, s.Scan(context.Background()))
+	assert.Equal(t, [][2]uint64{{101, 103}}, backend.queries)
+}
+
+func TestScanner_YoungChain(t *testing.T) {
+	backend := &chain{head: 1, fork: map[uint64]string{}, maxRange: 2000}
+	s, err := New(Config{Client: &chainClient{backend: backend}, AutomationCompatibleAddress: contract, Keeper: keeper, Enqueuer: &recordEnqueuer{ids: map[string]bool{}}, Checkpoint: NewMemoryCheckpoint(), Confirmations: 3})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Scan(context.Background()))
+	assert.Nil(t, s.book)
+
+	backend.head = 5
+	assert.NoError(t, s.Scan(context.Background()))
+	assert.Equal(t, uint64(2), s.book.state.Block)
+}
+
+func TestScanner_KeeperOnly(t *testing.T) {
+	for _, direct := range []bool{false, true} {
+		backend := &chain{
+			head:       10,
+			fork:       map[uint64]string{},
+			maxRange:   2000,
+			logs:       []types.Log{createdLog(3, 1), createdLog(4, 2)},
+			callable:   map[string]bool{orderKey(1) + ":cancel": true, orderKey(2) + ":execute": true},
+			keeperOnly: true,
+		}
+		enqueuer := &recordEnqueuer{ids: map[string]bool{}}
+		s, err := New(Config{
+			Client:                      &chainClient{backend: backend},
+			AutomationCompatibleAddress: contract,
+			Keeper:                      keeper,
+			Enqueuer:                    enqueuer,
+			Checkpoint:                  NewMemoryCheckpoint(),
+			FromBlock:                   1,
+			DirectCheck:                 direct,
+			Quote:                       quote,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, s.Scan(context.Background()))
+		// the checks reverted by Multicall3 as the sender are run again from the keeper
+		assert.Equal(t, []string{tasks.ACT_CANCEL_LIMIT_ORDER + ":1", tasks.ACT_LIMIT_ORDER + ":2"}, enqueuer.tasks, "direct %v", direct)
+		checked := 4
+		if !direct {
+			checked = 8
+		}
+		assert.Equal(t, checked, backend.checked, "direct %v", direct)
+	}
+}
@@ -3,4 +3,5 @@ package tasks
 const (
 	ACT_LIMIT_ORDER        = "act_limit_order"
 	ACT_CANCEL_LIMIT_ORDER = "act_cancel_limit_order"
+	ACT_TWAP_ORDER         = "act_twap_order"
 )
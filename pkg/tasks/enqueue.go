@@ -0,0 +1,77 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+var ErrDuplicateTask = errors.New("duplicate task")
+
+// Enqueuer is satisfied by *asynq.Client
+type Enqueuer interface {
+	EnqueueContext(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error)
+}
+
+// Inspector is satisfied by *asynq.Inspector
+type Inspector interface {
+	GetTaskInfo(queue, id string) (*asynq.TaskInfo, error)
+	DeleteTask(queue, id string) error
+}
+
+type inspectorKey struct{}
+
+// WithInspector lets EnqueueUnique replace the finished tasks holding the id of a task
+func WithInspector(ctx context.Context, inspector Inspector) context.Context {
+	return context.WithValue(ctx, inspectorKey{}, inspector)
+}
+
+// EnqueueUnique enqueues t, rejecting it with ErrDuplicateTask while a task with the same id or payload is kept
+func EnqueueUnique(ctx context.Context, client Enqueuer, t *asynq.Task, uniqueTTL time.Duration, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	if uniqueTTL > 0 {
+		opts = append(opts, asynq.Unique(uniqueTTL))
+	}
+	info, err := client.EnqueueContext(ctx, t, opts...)
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		var replaced bool
+		if replaced, err = replace(ctx, err, opts); replaced {
+			info, err = client.EnqueueContext(ctx, t, opts...)
+		}
+	}
+	if errors.Is(err, asynq.ErrTaskIDConflict) || errors.Is(err, asynq.ErrDuplicateTask) {
+		return nil, fmt.Errorf("%w: %w", ErrDuplicateTask, err)
+	}
+	return info, err
+}
+
+// replace deletes the archived or completed task holding the id of opts, it returns conflict otherwise
+func replace(ctx context.Context, conflict error, opts []asynq.Option) (bool, error) {
+	inspector, ok := ctx.Value(inspectorKey{}).(Inspector)
+	if !ok {
+		return false, conflict
+	}
+	// the last options win as in asynq
+	queue, id := "default", ""
+	for _, opt := range opts {
+		switch opt.Type() {
+		case asynq.QueueOpt:
+			queue = opt.Value().(string)
+		case asynq.TaskIDOpt:
+			id = opt.Value().(string)
+		}
+	}
+	if id == "" {
+		return false, conflict
+	}
+	held, err := inspector.GetTaskInfo(queue, id)
+	if err != nil || (held.State != asynq.TaskStateArchived && held.State != asynq.TaskStateCompleted) {
+		return false, conflict
+	}
+	if err := inspector.DeleteTask(queue, id); err != nil && !errors.Is(err, asynq.ErrTaskNotFound) {
+		return false, fmt.Errorf("replace the %s task %s: %w", held.State, id, err)
+	}
+	return true, nil
+}
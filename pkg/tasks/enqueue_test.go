@@ -0,0 +1,100 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+)
+
+type enqueuerFunc func(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error)
+
+func (f enqueuerFunc) EnqueueContext(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	return f(ctx, task, opts...)
+}
+
+func TestEnqueueUnique(t *testing.T) {
+	task := asynq.NewTask(ACT_LIMIT_ORDER, nil)
+
+	for _, err := range []error{asynq.ErrTaskIDConflict, asynq.ErrDuplicateTask} {
+		_, got := EnqueueUnique(context.Background(), enqueuerFunc(func(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+			return nil, err
+		}), task, time.Minute)
+		assert.ErrorIs(t, got, ErrDuplicateTask)
+		assert.ErrorIs(t, got, err)
+	}
+
+	other := errors.New("redis down")
+	_, got := EnqueueUnique(context.Background(), enqueuerFunc(func(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+		return nil, other
+	}), task, 0)
+	assert.NotErrorIs(t, got, ErrDuplicateTask)
+
+	var unique bool
+	_, got = EnqueueUnique(context.Background(), enqueuerFunc(func(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+		for _, opt := range opts {
+			unique = unique || opt.Type() == asynq.UniqueOpt
+		}
+		return &asynq.TaskInfo{}, nil
+	}), task, time.Minute)
+	assert.NoError(t, got)
+	assert.True(t, unique)
+}
+
+// keptQueue holds one task by queue and id, like asynq
+type keptQueue struct {
+	held    *asynq.TaskInfo
+	deleted bool
+}
+
+func (q *keptQueue) EnqueueContext(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	if q.held != nil {
+		return nil, asynq.ErrTaskIDConflict
+	}
+	q.held = &asynq.TaskInfo{ID: "id", Queue: "orders", State: asynq.TaskStatePending}
+	return q.held, nil
+}
+
+func (q *keptQueue) GetTaskInfo(queue, id string) (*asynq.TaskInfo, error) {
+	if q.held == nil || queue != q.held.Queue || id != q.held.ID {
+		return nil, asynq.ErrTaskNotFound
+	}
+	return q.held, nil
+}
+
+func (q *keptQueue) DeleteTask(queue, id string) error {
+	q.held, q.deleted = nil, true
+	return nil
+}
+
+func TestEnqueueUnique_Replace(t *testing.T) {
+	task := asynq.NewTask(ACT_LIMIT_ORDER, nil)
+	opts := []asynq.Option{asynq.Queue("orders"), asynq.TaskID("id")}
+	for state, replaced := range map[asynq.TaskState]bool{
+		asynq.TaskStateArchived:  true,
+		asynq.TaskStateCompleted: true,
+		asynq.TaskStatePending:   false,
+		asynq.TaskStateRetry:     false,
+	} {
+		q := &keptQueue{held: &asynq.TaskInfo{ID: "id", Queue: "orders", State: state}}
+		info, err := EnqueueUnique(WithInspector(context.Background(), q), q, task, 0, opts...)
+		if replaced {
+			assert.NoError(t, err, state)
+			assert.Equal(t, asynq.TaskStatePending, info.State, state)
+		} else {
+			assert.ErrorIs(t, err, ErrDuplicateTask, state)
+		}
+		assert.Equal(t, replaced, q.deleted, state)
+	}
+
+	// without inspector, or without the id
+	q := &keptQueue{held: &asynq.TaskInfo{ID: "id", Queue: "orders", State: asynq.TaskStateCompleted}}
+	_, err := EnqueueUnique(context.Background(), q, task, 0, opts...)
+	assert.ErrorIs(t, err, ErrDuplicateTask)
+	_, err = EnqueueUnique(WithInspector(context.Background(), q), q, task, 0, asynq.Queue("orders"))
+	assert.ErrorIs(t, err, ErrDuplicateTask)
+	assert.False(t, q.deleted)
+}
@@ -0,0 +1,122 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hibiken/asynq"
+	"github.com/tinkler/moonmist/pkg/jsonz/cjson"
+)
+
+// PanicError is returned by Recover in place of a panic of the handler
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Recover turns a panic of the handler into a PanicError, the task is not retried
+func Recover(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				err = fmt.Errorf("%w, %w", &PanicError{Value: v, Stack: debug.Stack()}, asynq.SkipRetry)
+			}
+		}()
+		return next.ProcessTask(ctx, t)
+	})
+}
+
+// asynqTimeout is the timeout asynq gives the tasks enqueued without asynq.Timeout or asynq.Deadline
+const asynqTimeout = 30 * time.Minute
+
+// Timeout gives the tasks enqueued without a timeout or a deadline the deadline d
+func Timeout(d time.Duration) asynq.MiddlewareFunc {
+	return func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+			deadline, ok := ctx.Deadline()
+			if left := time.Until(deadline); !ok || left > asynqTimeout-time.Minute && left <= asynqTimeout {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, d)
+				defer cancel()
+			}
+			return next.ProcessTask(ctx, t)
+		})
+	}
+}
+
+// ErrBusy defers the tasks of a network or a keeper processing its limit of tasks
+var ErrBusy = errors.New("busy")
+
+// Limiter defers the tasks while the slot of their network or keeper is busy
+type Limiter struct {
+	perNetwork int
+	perKeeper  int
+	// the delay of the deferred tasks, 5 seconds by default
+	Delay time.Duration
+
+	mu  sync.Mutex
+	sem map[string]chan struct{}
+}
+
+// NewLimiter creates a Limiter, a limit of 0 is unlimited
+func NewLimiter(perNetwork, perKeeper int) *Limiter {
+	return &Limiter{perNetwork: perNetwork, perKeeper: perKeeper, Delay: 5 * time.Second, sem: make(map[string]chan struct{})}
+}
+
+type limitedPayload struct {
+	NetworkName string
+	Keeper      common.Address
+}
+
+// Middleware defers the tasks whose slot is busy
+func (l *Limiter) Middleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		var p limitedPayload
+		// a malformed payload is left to the handler
+		_ = cjson.Unmarshal(t.Payload(), &p)
+		if p.NetworkName != "" && l.perNetwork > 0 {
+			release, err := l.acquire("network:"+p.NetworkName, l.perNetwork)
+			if err != nil {
+				return err
+			}
+			defer release()
+		}
+		if p.Keeper != (common.Address{}) && l.perKeeper > 0 {
+			release, err := l.acquire("keeper:"+p.Keeper.Hex(), l.perKeeper)
+			if err != nil {
+				return err
+			}
+			defer release()
+		}
+		return next.ProcessTask(ctx, t)
+	})
+}
+
+func (l *Limiter) acquire(key string, n int) (func(), error) {
+	l.mu.Lock()
+	sem, ok := l.sem[key]
+	if !ok {
+		sem = make(chan struct{}, n)
+		l.sem[key] = sem
+	}
+	l.mu.Unlock()
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	default:
+		delay := l.Delay
+		if delay <= 0 {
+			delay = 5 * time.Second
+		}
+		return nil, Defer(fmt.Errorf("%s: %w", key, ErrBusy), delay)
+	}
+}
@@ -0,0 +1,110 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecover(t *testing.T) {
+	h := Recover(asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		var m map[string]int
+		m["x"] = 1
+		return nil
+	}))
+	err := h.ProcessTask(context.Background(), asynq.NewTask(ACT_LIMIT_ORDER, nil))
+	var pe *PanicError
+	assert.ErrorAs(t, err, &pe)
+	assert.NotEmpty(t, pe.Stack)
+	assert.ErrorIs(t, err, asynq.SkipRetry)
+
+	ok := errors.New("ok")
+	assert.Equal(t, ok, Recover(asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		return ok
+	})).ProcessTask(context.Background(), asynq.NewTask(ACT_LIMIT_ORDER, nil)))
+}
+
+func TestTimeout(t *testing.T) {
+	var deadline time.Time
+	h := Timeout(time.Minute)(asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		deadline, _ = ctx.Deadline()
+		return nil
+	}))
+	task := asynq.NewTask(ACT_LIMIT_ORDER, nil)
+
+	assert.NoError(t, h.ProcessTask(context.Background(), task))
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	earlier, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	want, _ := earlier.Deadline()
+	assert.NoError(t, h.ProcessTask(earlier, task))
+	assert.Equal(t, want, deadline)
+
+	// the default of asynq
+	asynqDefault, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	assert.NoError(t, h.ProcessTask(asynqDefault, task))
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	// enqueued with its own timeout
+	later, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	want, _ = later.Deadline()
+	assert.NoError(t, h.ProcessTask(later, task))
+	assert.Equal(t, want, deadline)
+}
+
+func TestLimiter(t *testing.T) {
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	var ran atomic.Int32
+	h := NewLimiter(2, 1).Middleware(asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		ran.Add(1)
+		started.Done()
+		<-release
+		return nil
+	}))
+	payload := func(network, keeper string) *asynq.Task {
+		return asynq.NewTask(ACT_LIMIT_ORDER, []byte(`{"networkName":"`+network+`","keeper":"`+keeper+`"}`))
+	}
+	a, b, c := "0x0000000000000000000000000000000000000001", "0x0000000000000000000000000000000000000002", "0x0000000000000000000000000000000000000003"
+
+	// holds the slot of its network and keeper until released
+	var done sync.WaitGroup
+	hold := func(task *asynq.Task) {
+		started.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			assert.NoError(t, h.ProcessTask(context.Background(), task))
+		}()
+		started.Wait()
+	}
+	hold(payload("sepolia", a))
+	// one task per keeper, deferred rather than waiting
+	err := h.ProcessTask(context.Background(), payload("sepolia", a))
+	var de *DeferError
+	assert.ErrorAs(t, err, &de)
+	assert.ErrorIs(t, err, ErrBusy)
+	assert.Equal(t, 5*time.Second, de.Delay)
+	// two per network
+	hold(payload("sepolia", b))
+	assert.ErrorIs(t, h.ProcessTask(context.Background(), payload("sepolia", c)), ErrBusy)
+	// the other networks and the tasks without the fields are not held
+	hold(payload("mainnet", c))
+	hold(asynq.NewTask("other", nil))
+	assert.Equal(t, int32(4), ran.Load())
+
+	close(release)
+	done.Wait()
+	// the slots are released
+	started.Add(1)
+	assert.NoError(t, h.ProcessTask(context.Background(), payload("sepolia", a)))
+}
@@ -0,0 +1,209 @@
+package limit_keeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/pool"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hibiken/asynq"
+)
+
+var ErrNotExpired = errors.New("order not expired")
+
+// blockTime is the timestamp of the latest block
+func blockTime(ctx context.Context, client eclient.Ethclient) (time.Time, error) {
+	backend, err := client.GetClient(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	head, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("get the latest block: %w", err)
+	}
+	return time.Unix(int64(head.Time), 0), nil
+}
+
+// expired tells whether the latest block reached expiresAt
+func expired(ctx context.Context, client eclient.Ethclient, expiresAt int64) (bool, error) {
+	now, err := blockTime(ctx, client)
+	if err != nil {
+		return false, err
+	}
+	return now.Unix() >= expiresAt, nil
+}
+
+// waitExpiry defers the cancel of o until the latest block reaches expiresAt
+func waitExpiry(ctx context.Context, client eclient.Ethclient, o order.Order, expiresAt int64) error {
+	if spec, ok := order.LookupOrderType(o.OrderType); ok && !spec.CancelOnlyWhenExpired {
+		return nil
+	}
+	now, err := blockTime(ctx, client)
+	if err != nil {
+		return err
+	}
+	if now.Unix() >= expiresAt {
+		return nil
+	}
+	// the block after the expiry is mined a block time later at worst
+	delay := time.Unix(expiresAt, 0).Sub(now) + time.Second
+	return tasks.Defer(fmt.Errorf("%w: block time %d, expiry %d", ErrNotExpired, now.Unix(), expiresAt), delay)
+}
+
+// Enqueue enqueues t like tasks.EnqueueUnique, and the cancel of its order at its Expiry
+func Enqueue(ctx context.Context, client tasks.Enqueuer, t *asynq.Task, uniqueTTL time.Duration, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	cancel, cancelID, err := expiryCancelTask(t)
+	if err != nil {
+		return nil, err
+	}
+	if _, id, ok := taskIDOf(t, opts); ok {
+		// the id of the task, which asynq keeps unexported, for the replacement
+		opts = append([]asynq.Option{asynq.TaskID(id)}, opts...)
+	}
+	info, err := tasks.EnqueueUnique(ctx, client, t, uniqueTTL, opts...)
+	if err != nil || cancel == nil {
+		return info, err
+	}
+	// a duplicate is the cancel of a previous enqueue
+	if _, err := tasks.EnqueueUnique(ctx, client, cancel, 0, asynq.Queue(info.Queue), asynq.TaskID(cancelID)); err != nil && !errors.Is(err, tasks.ErrDuplicateTask) {
+		return info, fmt.Errorf("schedule the cancel at expiry: %w", err)
+	}
+	return info, nil
+}
+
+// taskIDOf is the queue and the id t is enqueued with, the last options win as in asynq
+func taskIDOf(t *asynq.Task, opts []asynq.Option) (queue string, id string, ok bool) {
+	queue = "default"
+	for _, opt := range opts {
+		switch opt.Type() {
+		case asynq.QueueOpt:
+			queue = opt.Value().(string)
+		case asynq.TaskIDOpt:
+			id = opt.Value().(string)
+		}
+	}
+	if id != "" {
+		return queue, id, true
+	}
+	switch t.Type() {
+	case tasks.ACT_LIMIT_ORDER:
+		p, err := parsePayloadFrom(t)
+		if err != nil {
+			return "", "", false
+		}
+		id = TaskID(p.NetworkName, p.AutomationCompatibleAddress, p.LimitOrder.Order, false)
+	case tasks.ACT_CANCEL_LIMIT_ORDER:
+		p, err := parseCancelPayloadFrom(t)
+		if err != nil {
+			return "", "", false
+		}
+		id = TaskID(p.NetworkName, p.AutomationCompatibleAddress, p.Order, true)
+	case tasks.ACT_TWAP_ORDER:
+		p, err := parseTWAPPayloadFrom(t)
+		if err != nil {
+			return "", "", false
+		}
+		id = TWAPTaskID(p.NetworkName, p.AutomationCompatibleAddress, p.LimitOrder.Order, p.Slice)
+	default:
+		return "", "", false
+	}
+	return queue, id, true
+}
+
+// expiryCancelTask is the cancel of the order of t at its expiry and its id, nil when it has none
+func expiryCancelTask(t *asynq.Task) (*asynq.Task, string, error) {
+	var p *payload
+	switch t.Type() {
+	case tasks.ACT_LIMIT_ORDER:
+		v, err := parsePayloadFrom(t)
+		if err != nil {
+			return nil, "", err
+		}
+		p = v
+	case tasks.ACT_TWAP_ORDER:
+		v, err := parseTWAPPayloadFrom(t)
+		if err != nil {
+			return nil, "", err
+		}
+		p = &v.payload
+	default:
+		return nil, "", nil
+	}
+	if p.ExpiresAt == 0 {
+		return nil, "", nil
+	}
+	// an explicit cancel of the order is not a duplicate of the scheduled one
+	id := ExpiryCancelTaskID(p.NetworkName, p.AutomationCompatibleAddress, p.LimitOrder.Order)
+	opts := []asynq.Option{Expiry(time.Unix(p.ExpiresAt, 0)), asynq.TaskID(id)}
+	if p.CallbackURL != "" {
+		opts = append(opts, Callback(p.CallbackURL))
+	}
+	if p.Trace != nil {
+		opts = append(opts, traceOption(p.Trace))
+	}
+	cancel, err := NewCancelTask(p.NetworkName, p.AutomationCompatibleAddress.Hex(), p.Keeper.Hex(), p.LimitOrder.Order, opts...)
+	return cancel, id, err
+}
+
+// ExpiryCancelTaskID is the id of the cancel scheduled by Enqueue at the expiry of order
+func ExpiryCancelTaskID(networkName string, automationCompatibleAddr common.Address, order order.Order) string {
+	return TaskID(networkName, automationCompatibleAddr, order, true) + ":expiry"
+}
+
+// TaskDeleter is satisfied by *asynq.Inspector
+type TaskDeleter interface {
+	DeleteTask(queue, id string) error
+}
+
+type taskDeleterKey struct{}
+
+// WithTaskDeleter deletes the cancel scheduled at the expiry of an order once it is filled
+func WithTaskDeleter(ctx context.Context, deleter TaskDeleter) context.Context {
+	return context.WithValue(ctx, taskDeleterKey{}, deleter)
+}
+
+// filled tells whether the execution of p left nothing of the order
+func filled(p *payload, r *Result) bool {
+	if r.Outcome != "" {
+		return false
+	}
+	remaining := new(big.Int).Sub(p.LimitOrder.RemainingAmountIn, p.LimitOrder.AmountIn)
+	if r.Fill != nil && r.Fill.RemainingAmountIn != nil {
+		remaining = r.Fill.RemainingAmountIn
+	}
+	return remaining.Sign() <= 0
+}
+
+// suppressCancel deletes the cancel scheduled at the expiry of the order of p once it is filled
+func suppressCancel(ctx context.Context, p *payload, r *Result) {
+	if p.ExpiresAt == 0 || !filled(p, r) {
+		return
+	}
+	deleter, ok := ctx.Value(taskDeleterKey{}).(TaskDeleter)
+	if !ok {
+		return
+	}
+	queue, ok := asynq.GetQueueName(ctx)
+	if !ok {
+		return
+	}
+	logger := r.logger
+	if logger == nil {
+		logger = pool.Logger(ctx)
+	}
+	id := ExpiryCancelTaskID(p.NetworkName, p.AutomationCompatibleAddress, p.LimitOrder.Order)
+	if err := deleter.DeleteTask(queue, id); err != nil {
+		if !errors.Is(err, asynq.ErrTaskNotFound) {
+			logger.Warn("expiry cancel not suppressed", slog.String("cancelTaskId", id), slog.String("error", err.Error()))
+		}
+		return
+	}
+	logger.Info("expiry cancel suppressed", slog.String("cancelTaskId", id))
+}
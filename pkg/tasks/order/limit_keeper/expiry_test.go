@@ -0,0 +1,204 @@
+package limit_keeper
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+)
+
+// headBackend answers the latest header with the block time
+type headBackend struct {
+	bind.ContractBackend
+	time uint64
+}
+
+func (b *headBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{Number: big.NewInt(1), Time: b.time}, nil
+}
+
+type headClient struct {
+	resumeClient
+	backend *headBackend
+}
+
+func (c *headClient) GetClient(ctx context.Context) (bind.ContractBackend, error) {
+	return c.backend, nil
+}
+
+func TestExpiry(t *testing.T) {
+	expiry := time.Unix(1700000000, 0)
+	client := &headClient{backend: &headBackend{time: uint64(expiry.Unix()) - 30}}
+	ctx := context.Background()
+
+	isExpired, err := expired(ctx, client, expiry.Unix())
+	assert.NoError(t, err)
+	assert.False(t, isExpired)
+
+	// the chain is behind the wall clock, the cancel waits for the block after the expiry
+	limit := twapInput().Order
+	err = waitExpiry(ctx, client, limit, expiry.Unix())
+	assert.ErrorIs(t, err, ErrNotExpired)
+	var de *tasks.DeferError
+	if assert.ErrorAs(t, err, &de) {
+		assert.Equal(t, 31*time.Second, de.Delay)
+	}
+	// unknown types are only cancelled once expired as well
+	unknown := limit
+	unknown.OrderType = big.NewInt(99)
+	assert.ErrorIs(t, waitExpiry(ctx, client, unknown, expiry.Unix()), ErrNotExpired)
+	// cancelled at any time
+	if _, ok := order.LookupOrderType(big.NewInt(98)); !ok {
+		assert.NoError(t, order.RegisterOrderType(order.OrderTypeSpec{ID: 98, Name: "test_cancel_anytime"}))
+	}
+	anytime := limit
+	anytime.OrderType = big.NewInt(98)
+	assert.NoError(t, waitExpiry(ctx, client, anytime, expiry.Unix()))
+
+	client.backend.time = uint64(expiry.Unix())
+	isExpired, err = expired(ctx, client, expiry.Unix())
+	assert.NoError(t, err)
+	assert.True(t, isExpired)
+	assert.NoError(t, waitExpiry(ctx, client, limit, expiry.Unix()))
+
+	r := new(Result)
+	err = r.report(ctx, asynq.NewTask(tasks.ACT_CANCEL_LIMIT_ORDER, nil), waitExpiry(ctx, &headClient{backend: &headBackend{}}, limit, expiry.Unix()))
+	assert.ErrorIs(t, err, ErrNotExpired)
+	assert.Equal(t, OutcomeWaiting, r.Outcome)
+}
+
+func TestEnqueue_Expiry(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	enqueuer := new(recordEnqueuer)
+	task, err := NewNormalTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", twapInput(), Expiry(expiry), Callback("https://example.com/done"))
+	assert.NoError(t, err)
+	_, err = Enqueue(context.Background(), enqueuer, task, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, enqueuer.tasks, 2) {
+		assert.Equal(t, tasks.ACT_LIMIT_ORDER, enqueuer.tasks[0].Type())
+		cancel := enqueuer.tasks[1]
+		assert.Equal(t, tasks.ACT_CANCEL_LIMIT_ORDER, cancel.Type())
+		p, err := parseCancelPayloadFrom(cancel)
+		assert.NoError(t, err)
+		assert.Equal(t, expiry.Unix(), p.ExpiresAt)
+		assert.Equal(t, "https://example.com/done", p.CallbackURL)
+		assert.Equal(t, twapInput().Order.Key(), p.Order.Key())
+	}
+
+	// the cancel of a previous enqueue is kept
+	enqueuer = &recordEnqueuer{}
+	task, err = NewTWAPTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", twapInput(), 2, time.Minute, Expiry(expiry))
+	assert.NoError(t, err)
+	_, err = Enqueue(context.Background(), &duplicateCancelEnqueuer{enqueuer}, task, 0)
+	assert.NoError(t, err)
+	assert.Len(t, enqueuer.tasks, 1)
+
+	// without expiry
+	enqueuer = new(recordEnqueuer)
+	task, err = NewNormalTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", twapInput())
+	assert.NoError(t, err)
+	_, err = Enqueue(context.Background(), enqueuer, task, 0)
+	assert.NoError(t, err)
+	assert.Len(t, enqueuer.tasks, 1)
+
+	_, err = NewNormalTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", twapInput(), Expiry(time.Time{}))
+	assert.Error(t, err)
+}
+
+// duplicateCancelEnqueuer rejects the cancel tasks as duplicates
+type duplicateCancelEnqueuer struct {
+	*recordEnqueuer
+}
+
+func (e *duplicateCancelEnqueuer) EnqueueContext(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	if task.Type() == tasks.ACT_CANCEL_LIMIT_ORDER {
+		return nil, asynq.ErrTaskIDConflict
+	}
+	return e.recordEnqueuer.EnqueueContext(ctx, task, opts...)
+}
+
+func TestFilled(t *testing.T) {
+	p := &payload{LimitOrder: twapInput()}
+	assert.True(t, filled(p, new(Result)))
+	assert.False(t, filled(p, &Result{Outcome: OutcomeNotCallable}))
+	// a partial fill
+	assert.False(t, filled(p, &Result{Fill: &order.Fill{AmountIn: big.NewInt(400), RemainingAmountIn: big.NewInt(600)}}))
+
+	p.LimitOrder.AmountIn = big.NewInt(400)
+	assert.False(t, filled(p, new(Result)))
+	assert.True(t, filled(p, &Result{Fill: &order.Fill{AmountIn: big.NewInt(1000), RemainingAmountIn: big.NewInt(0)}}))
+}
+
+// heldQueue rejects the tasks of a type with an id held in the queue
+type heldQueue struct {
+	recordEnqueuer
+	held    map[string]*asynq.TaskInfo
+	deleted []string
+}
+
+func (q *heldQueue) EnqueueContext(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	for _, info := range q.held {
+		if info.Type == task.Type() {
+			return nil, asynq.ErrTaskIDConflict
+		}
+	}
+	return q.recordEnqueuer.EnqueueContext(ctx, task, opts...)
+}
+
+func (q *heldQueue) GetTaskInfo(queue, id string) (*asynq.TaskInfo, error) {
+	info, ok := q.held[queue+"/"+id]
+	if !ok {
+		return nil, asynq.ErrTaskNotFound
+	}
+	return info, nil
+}
+
+func (q *heldQueue) DeleteTask(queue, id string) error {
+	delete(q.held, queue+"/"+id)
+	q.deleted = append(q.deleted, id)
+	return nil
+}
+
+func TestEnqueue_Replace(t *testing.T) {
+	contract := common.HexToAddress("0x000000000000000000000000000000000000c0ff")
+	id := TaskID("sepolia", contract, twapInput().Order, false)
+	task, err := NewNormalTask("sepolia", contract.Hex(), "0x0000000000000000000000000000000000001234", twapInput())
+	assert.NoError(t, err)
+
+	for state, replaced := range map[asynq.TaskState]bool{
+		asynq.TaskStateArchived:  true,
+		asynq.TaskStateCompleted: true,
+		asynq.TaskStatePending:   false,
+		asynq.TaskStateRetry:     false,
+	} {
+		q := &heldQueue{held: map[string]*asynq.TaskInfo{"orders/" + id: {ID: id, Type: tasks.ACT_LIMIT_ORDER, State: state}}}
+		_, err := Enqueue(tasks.WithInspector(context.Background(), q), q, task, 0, asynq.Queue("orders"))
+		if replaced {
+			assert.NoError(t, err, state)
+			assert.Equal(t, []string{id}, q.deleted, state)
+			assert.Len(t, q.tasks, 1, state)
+		} else {
+			assert.ErrorIs(t, err, tasks.ErrDuplicateTask, state)
+			assert.Empty(t, q.deleted, state)
+		}
+	}
+
+	// without inspector
+	q := &heldQueue{held: map[string]*asynq.TaskInfo{"orders/" + id: {ID: id, Type: tasks.ACT_LIMIT_ORDER, State: asynq.TaskStateArchived}}}
+	_, err = Enqueue(context.Background(), q, task, 0, asynq.Queue("orders"))
+	assert.ErrorIs(t, err, tasks.ErrDuplicateTask)
+
+	// the id of the options
+	q.held = map[string]*asynq.TaskInfo{"default/v2": {ID: "v2", Type: tasks.ACT_LIMIT_ORDER, State: asynq.TaskStateCompleted}}
+	_, err = Enqueue(tasks.WithInspector(context.Background(), q), q, task, 0, asynq.TaskID("v2"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v2"}, q.deleted)
+}
@@ -4,19 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math/big"
 	"sync"
+	"time"
 
 	"github.com/WEPublicGoods/wetask/pkg/eth/com"
 	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
-	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/metrics"
 	"github.com/WEPublicGoods/wetask/pkg/pool"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/hibiken/asynq"
 	"github.com/tinkler/moonmist/pkg/jsonz/cjson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func parsePayloadFrom(t *asynq.Task) (*payload, error) {
@@ -28,26 +33,66 @@ func parsePayloadFrom(t *asynq.Task) (*payload, error) {
 }
 
 func Handle(ctx context.Context, t *asynq.Task) error {
+	r := new(Result)
+	return r.report(ctx, t, handle(ctx, t, r))
+}
+
+func handle(ctx context.Context, t *asynq.Task, r *Result) error {
 	p, err := parsePayloadFrom(t)
 	if err != nil {
 		return err
 	}
+	if err := execute(ctx, p, r, "limit_keeper.Handle"); err != nil {
+		return onlyDeferred(err)
+	}
+	suppressCancel(ctx, p, r)
+	return nil
+}
+
+// executeFunc executes the order of p, starting the span name
+type executeFunc func(ctx context.Context, p *payload, r *Result, name string) error
+
+// onlyDeferred makes the failures of an execution final unless they defer the task
+func onlyDeferred(err error) error {
+	var de *tasks.DeferError
+	if err == nil || errors.As(err, &de) || errors.Is(err, asynq.SkipRetry) {
+		return err
+	}
+	return fmt.Errorf("%w, %w", err, asynq.SkipRetry)
+}
+
+func execute(ctx context.Context, p *payload, r *Result, name string) error {
+	r.setPayload(p)
+	ctx = r.startTask(ctx, name, p.Trace)
 	client, ok := pool.GetClient(ctx, p.NetworkName)
 	if !ok {
 		return fmt.Errorf("network %s is not support, %w", p.NetworkName, asynq.SkipRetry)
 	}
-	orderData, err := order.LimitOrderExecuteInputABI.Pack(
-		p.LimitOrder.Order,
-		false,
-		p.LimitOrder.TokenIn,
-		p.LimitOrder.TokenOut,
-		p.LimitOrder.RemainingAmountIn,
-		p.LimitOrder.Routes,
-		p.LimitOrder.AmountIn,
-		p.LimitOrder.AmountOutMin,
-		p.LimitOrder.AmountOutExpected,
-		p.Keeper,
-	)
+	jr := openJournal(ctx, p.NetworkName, p.AutomationCompatibleAddress, p.LimitOrder.Order, false)
+	if receipt, resumed, err := jr.resume(ctx, client, r); resumed {
+		r.confirmed(receipt)
+		if err == nil {
+			r.decodeFill(ctx, receipt, &p.LimitOrder)
+		}
+		return err
+	}
+	if p.ExpiresAt != 0 {
+		isExpired, err := expired(ctx, client, p.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		if isExpired {
+			// only the cancel is left to the order
+			r.Outcome = OutcomeExpired
+			return nil
+		}
+	}
+	if p.Trigger != nil {
+		if err := checkTrigger(ctx, client, p.Trigger); err != nil {
+			return err
+		}
+	}
+	orderData, err := p.orderData(ctx)
 	if err != nil {
 		return fmt.Errorf("pack order data %v error:%s, %w", p.LimitOrder, err.Error(), asynq.SkipRetry)
 	}
@@ -112,22 +157,47 @@ func Handle(ctx context.Context, t *asynq.Task) error {
 					Value:     transactOpts.Value,
 					Data:      input,
 				}
-				gasLimit, err := backend.EstimateGas(ctx, msg)
+				gasLimit, err := estimateGas(ctx, backend, msg)
 				if err != nil {
 					return err
 				}
 				transactOpts.GasLimit = uint64(float64(gasLimit) * p.GasLimitMultiplier)
 			}
 		}
+		if _, ok := getProfitPolicy(ctx, p.NetworkName); ok {
+			backend, err := client.GetClient(ctx)
+			if err != nil {
+				return err
+			}
+			parsed, err := com.AutomationCompatibleMetaData.GetAbi()
+			if err != nil {
+				return err
+			}
+			input, err := parsed.Pack("performUpkeep", orderData)
+			if err != nil {
+				return err
+			}
+			err = estimateProfit(ctx, p.NetworkName, p.LimitOrder.Order.ExecuteFee, backend, &p.AutomationCompatibleAddress, transactOpts, input)
+			if err != nil {
+				return err
+			}
+		}
 
-		performTx, err := performUpkeep(ctx, client, transactOpts, p.AutomationCompatibleAddress, orderData)
+		performTx, err := jr.performUpkeep(ctx, client, transactOpts, p.AutomationCompatibleAddress, orderData)
 		if err != nil {
 			return err
 		}
-		_, err = client.WaitForReceipt(ctx, performTx.Hash())
+		r.sent(ctx, performTx)
+		receipt, err := client.WaitForReceipt(ctx, performTx.Hash())
+		jr.close(ctx, err)
+		r.confirmed(receipt)
+		if err == nil {
+			r.decodeFill(ctx, receipt, &p.LimitOrder)
+		}
 		return err
 	}
 
+	r.Outcome = OutcomeNotCallable
 	return nil
 }
 
@@ -152,26 +222,54 @@ func (oe *OptimizeExecutor) getKeeper(keeperAddr common.Address) *keeper {
 
 // make sure the unsorted transactions can be accept by the RPC node
 func (oe *OptimizeExecutor) Handle(ctx context.Context, t *asynq.Task) error {
+	r := new(Result)
+	return r.report(ctx, t, oe.handle(ctx, t, r))
+}
+
+func (oe *OptimizeExecutor) handle(ctx context.Context, t *asynq.Task, r *Result) error {
 	p, err := parsePayloadFrom(t)
 	if err != nil {
 		return err
 	}
+	if err := oe.execute(ctx, p, r, "limit_keeper.OptimizeExecutor.Handle"); err != nil {
+		return onlyDeferred(err)
+	}
+	suppressCancel(ctx, p, r)
+	return nil
+}
+
+func (oe *OptimizeExecutor) execute(ctx context.Context, p *payload, r *Result, name string) error {
+	r.setPayload(p)
+	ctx = r.startTask(ctx, name, p.Trace)
 	client, ok := pool.GetClient(ctx, p.NetworkName)
 	if !ok {
 		return fmt.Errorf("network %s is not support, %w", p.NetworkName, asynq.SkipRetry)
 	}
-	orderData, err := order.LimitOrderExecuteInputABI.Pack(
-		p.LimitOrder.Order,
-		false,
-		p.LimitOrder.TokenIn,
-		p.LimitOrder.TokenOut,
-		p.LimitOrder.RemainingAmountIn,
-		p.LimitOrder.Routes,
-		p.LimitOrder.AmountIn,
-		p.LimitOrder.AmountOutMin,
-		p.LimitOrder.AmountOutExpected,
-		p.Keeper,
-	)
+	jr := openJournal(ctx, p.NetworkName, p.AutomationCompatibleAddress, p.LimitOrder.Order, false)
+	if receipt, resumed, err := jr.resume(ctx, client, r); resumed {
+		r.confirmed(receipt)
+		if err == nil {
+			r.decodeFill(ctx, receipt, &p.LimitOrder)
+		}
+		return err
+	}
+	if p.ExpiresAt != 0 {
+		isExpired, err := expired(ctx, client, p.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		if isExpired {
+			// only the cancel is left to the order
+			r.Outcome = OutcomeExpired
+			return nil
+		}
+	}
+	if p.Trigger != nil {
+		if err := checkTrigger(ctx, client, p.Trigger); err != nil {
+			return err
+		}
+	}
+	orderData, err := p.orderData(ctx)
 	if err != nil {
 		return fmt.Errorf("pack order data %v error:%s, %w", p.LimitOrder, err.Error(), asynq.SkipRetry)
 	}
@@ -221,40 +319,73 @@ func (oe *OptimizeExecutor) Handle(ctx context.Context, t *asynq.Task) error {
 		}
 
 		multiplier := float64(1)
+		var lastHash common.Hash
 		send := func() (common.Hash, error) {
+			gasFeeCap, gasLimit := transactOpts.GasFeeCap, transactOpts.GasLimit
 			increaseGas(ctx, backend, &p.AutomationCompatibleAddress, transactOpts, input, multiplier)
 			multiplier += 0.1 // next increase with 10%
-			performTx, err := performUpkeep(ctx, client, transactOpts, p.AutomationCompatibleAddress, orderData)
+			err := checkProfit(ctx, p.NetworkName, p.LimitOrder.Order.ExecuteFee, transactOpts.GasLimit, transactOpts.GasFeeCap)
 			if err != nil {
+				if lastHash == (common.Hash{}) {
+					return common.Hash{}, err
+				}
+				// keep waiting for the sent transaction rather than bumping at a loss
+				pool.Logger(ctx).Info("fee bump skipped", slog.String("reason", err.Error()), slog.String("tx", lastHash.Hex()))
+				transactOpts.GasFeeCap, transactOpts.GasLimit = gasFeeCap, gasLimit
+				return lastHash, nil
+			}
+			performTx, err := jr.performUpkeep(ctx, client, transactOpts, p.AutomationCompatibleAddress, orderData)
+			if err != nil {
+				if lastHash != (common.Hash{}) && overGasPolicy(err) {
+					pool.Logger(ctx).Info("fee bump skipped", slog.String("reason", err.Error()), slog.String("tx", lastHash.Hex()))
+					transactOpts.GasFeeCap, transactOpts.GasLimit = gasFeeCap, gasLimit
+					return lastHash, nil
+				}
 				return common.Hash{}, err
 			}
-			return performTx.Hash(), nil
+			r.sent(ctx, performTx)
+			lastHash = performTx.Hash()
+			return lastHash, nil
+		}
+		receipt, err := client.UrgeReceipt(ctx, send, 3) // fail after 130%
+		jr.close(ctx, err)
+		r.confirmed(receipt)
+		if err == nil {
+			r.decodeFill(ctx, receipt, &p.LimitOrder)
 		}
-		_, err = client.UrgeReceipt(ctx, send, 3) // fail after 130%
 		return err
 	}
+	r.Outcome = OutcomeNotCallable
 	return nil
 }
 
 func (oe *OptimizeExecutor) HandleCancel(ctx context.Context, t *asynq.Task) error {
+	r := &Result{Cancel: true}
+	return r.report(ctx, t, oe.handleCancel(ctx, t, r))
+}
+
+func (oe *OptimizeExecutor) handleCancel(ctx context.Context, t *asynq.Task, r *Result) error {
 	p, err := parseCancelPayloadFrom(t)
 	if err != nil {
 		return err
 	}
+	r.setCancelPayload(p)
+	ctx = r.startTask(ctx, "limit_keeper.OptimizeExecutor.HandleCancel", p.Trace)
 	client, ok := pool.GetClient(ctx, p.NetworkName)
 	if !ok {
 		return fmt.Errorf("network %s is not support, %w", p.NetworkName, asynq.SkipRetry)
 	}
-	orderData, err := order.LimitOrderExecuteInputABI.Pack(p.Order,
-		true,
-		common.Address{},
-		common.Address{},
-		big.NewInt(0),
-		[]order.SwapRoute{},
-		big.NewInt(0),
-		big.NewInt(0),
-		big.NewInt(0),
-		p.Keeper)
+	jr := openJournal(ctx, p.NetworkName, p.AutomationCompatibleAddress, p.Order, true)
+	if receipt, resumed, err := jr.resume(ctx, client, r); resumed {
+		r.confirmed(receipt)
+		return err
+	}
+	if p.ExpiresAt != 0 {
+		if err := waitExpiry(ctx, client, p.Order, p.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	orderData, err := p.orderData(ctx)
 	if err != nil {
 		return fmt.Errorf("pack order data %v error:%s, %w", p.Order, err.Error(), asynq.SkipRetry)
 	}
@@ -303,18 +434,31 @@ func (oe *OptimizeExecutor) HandleCancel(ctx context.Context, t *asynq.Task) err
 		}
 
 		multiplier := float64(1)
+		var lastHash common.Hash
 		send := func() (common.Hash, error) {
+			gasFeeCap, gasLimit := transactOpts.GasFeeCap, transactOpts.GasLimit
 			increaseGas(ctx, backend, &p.AutomationCompatibleAddress, transactOpts, input, multiplier)
 			multiplier += 0.1 // next increase with 10%
-			performTx, err := performUpkeep(ctx, client, transactOpts, p.AutomationCompatibleAddress, orderData)
+			performTx, err := jr.performUpkeep(ctx, client, transactOpts, p.AutomationCompatibleAddress, orderData)
 			if err != nil {
+				if lastHash != (common.Hash{}) && overGasPolicy(err) {
+					// keep waiting for the sent transaction rather than bumping over the policy
+					pool.Logger(ctx).Info("fee bump skipped", slog.String("reason", err.Error()), slog.String("tx", lastHash.Hex()))
+					transactOpts.GasFeeCap, transactOpts.GasLimit = gasFeeCap, gasLimit
+					return lastHash, nil
+				}
 				return common.Hash{}, err
 			}
-			return performTx.Hash(), nil
+			r.sent(ctx, performTx)
+			lastHash = performTx.Hash()
+			return lastHash, nil
 		}
-		_, err = client.UrgeReceipt(ctx, send, 3) // fail after 130%
+		receipt, err := client.UrgeReceipt(ctx, send, 3) // fail after 130%
+		jr.close(ctx, err)
+		r.confirmed(receipt)
 		return err
 	}
+	r.Outcome = OutcomeNotCallable
 	return nil
 }
 
@@ -337,7 +481,7 @@ func increaseGas(ctx context.Context, backend bind.ContractBackend, automationCo
 		Value:     transactOpts.Value,
 		Data:      input,
 	}
-	gasLimit, err := backend.EstimateGas(ctx, msg)
+	gasLimit, err := estimateGas(ctx, backend, msg)
 	if err != nil {
 		return err
 	}
@@ -346,6 +490,20 @@ func increaseGas(ctx context.Context, backend bind.ContractBackend, automationCo
 	return nil
 }
 
+func estimateGas(ctx context.Context, backend bind.ContractBackend, msg ethereum.CallMsg) (gasLimit uint64, err error) {
+	ctx, span := tracer.Start(ctx, "estimateGas")
+	defer func() {
+		span.SetAttributes(attribute.Int64("wetask.gas_limit", int64(gasLimit)))
+		endSpan(span, err)
+	}()
+	return backend.EstimateGas(ctx, msg)
+}
+
+// overGasPolicy reports whether the signer refused the transaction because of the gas policy
+func overGasPolicy(err error) bool {
+	return errors.Is(err, pool.ErrGasCapExceeded) || errors.Is(err, pool.ErrBudgetExceeded)
+}
+
 func parseCancelPayloadFrom(t *asynq.Task) (*cancelPayload, error) {
 	var p cancelPayload
 	if err := cjson.Unmarshal(t.Payload(), &p); err != nil {
@@ -355,24 +513,32 @@ func parseCancelPayloadFrom(t *asynq.Task) (*cancelPayload, error) {
 }
 
 func HandleCancel(ctx context.Context, t *asynq.Task) error {
+	r := &Result{Cancel: true}
+	return r.report(ctx, t, handleCancel(ctx, t, r))
+}
+
+func handleCancel(ctx context.Context, t *asynq.Task, r *Result) error {
 	p, err := parseCancelPayloadFrom(t)
 	if err != nil {
 		return err
 	}
+	r.setCancelPayload(p)
+	ctx = r.startTask(ctx, "limit_keeper.HandleCancel", p.Trace)
 	client, ok := pool.GetClient(ctx, p.NetworkName)
 	if !ok {
 		return fmt.Errorf("network %s is not support, %w", p.NetworkName, asynq.SkipRetry)
 	}
-	orderData, err := order.LimitOrderExecuteInputABI.Pack(p.Order,
-		true,
-		common.Address{},
-		common.Address{},
-		big.NewInt(0),
-		[]order.SwapRoute{},
-		big.NewInt(0),
-		big.NewInt(0),
-		big.NewInt(0),
-		p.Keeper)
+	jr := openJournal(ctx, p.NetworkName, p.AutomationCompatibleAddress, p.Order, true)
+	if receipt, resumed, err := jr.resume(ctx, client, r); resumed {
+		r.confirmed(receipt)
+		return err
+	}
+	if p.ExpiresAt != 0 {
+		if err := waitExpiry(ctx, client, p.Order, p.ExpiresAt); err != nil {
+			return err
+		}
+	}
+	orderData, err := p.orderData(ctx)
 	if err != nil {
 		return fmt.Errorf("pack order data %v error:%s, %w", p.Order, err.Error(), asynq.SkipRetry)
 	}
@@ -390,19 +556,30 @@ func HandleCancel(ctx context.Context, t *asynq.Task) error {
 		if err != nil {
 			return fmt.Errorf("%s, %w", err.Error(), asynq.SkipRetry)
 		}
-		performTx, err := performUpkeep(ctx, client, transactOpts, p.AutomationCompatibleAddress, orderData)
+		performTx, err := jr.performUpkeep(ctx, client, transactOpts, p.AutomationCompatibleAddress, orderData)
 		if err != nil {
 			return err
 		}
-		_, err = client.WaitForReceipt(ctx, performTx.Hash())
+		r.sent(ctx, performTx)
+		receipt, err := client.WaitForReceipt(ctx, performTx.Hash())
+		jr.close(ctx, err)
+		r.confirmed(receipt)
 		return err
 	}
 
+	r.Outcome = OutcomeNotCallable
 	return nil
 }
 
 func checkUpkeep(ctx context.Context, client eclient.Ethclient, opts *bind.CallOpts, automationCompatibleAddress common.Address, checkData []byte) (callable bool, executeData []byte, err error) {
 	executeData = make([]byte, 0)
+	ctx, span := tracer.Start(ctx, "checkUpkeep")
+	defer func(start time.Time) {
+		metrics.ObserveCheckUpkeep(client.Network(), time.Since(start))
+		pool.Logger(ctx).Debug("checkUpkeep", slog.Bool("callable", callable), slog.Duration("took", time.Since(start)))
+		span.SetAttributes(attribute.Bool("wetask.callable", callable))
+		endSpan(span, err)
+	}(time.Now())
 
 	stub, err := client.GetClient(ctx)
 	if err != nil {
@@ -412,6 +589,9 @@ func checkUpkeep(ctx context.Context, client eclient.Ethclient, opts *bind.CallO
 	if err != nil {
 		return false, nil, err
 	}
+	if opts.Context == nil {
+		opts.Context = ctx
+	}
 	result := []interface{}{
 		&callable,
 		&executeData,
@@ -424,7 +604,15 @@ func checkUpkeep(ctx context.Context, client eclient.Ethclient, opts *bind.CallO
 	return
 }
 
-func performUpkeep(ctx context.Context, client eclient.Ethclient, opts *bind.TransactOpts, automationCompatibleAddress common.Address, performData []byte) (*types.Transaction, error) {
+// performUpkeep estimates the gas left unset by opts, signs and sends the transaction unless opts.NoSend
+func performUpkeep(ctx context.Context, client eclient.Ethclient, opts *bind.TransactOpts, automationCompatibleAddress common.Address, performData []byte) (tx *types.Transaction, err error) {
+	ctx, span := tracer.Start(ctx, "performUpkeep", trace.WithAttributes(attribute.Bool("wetask.no_send", opts.NoSend)))
+	defer func() {
+		if tx != nil {
+			span.SetAttributes(attribute.String("wetask.tx_hash", tx.Hash().Hex()), attribute.Int64("wetask.nonce", int64(tx.Nonce())))
+		}
+		endSpan(span, err)
+	}()
 	stub, err := client.GetClient(ctx)
 	if err != nil {
 		return nil, err
@@ -433,5 +621,22 @@ func performUpkeep(ctx context.Context, client eclient.Ethclient, opts *bind.Tra
 	if err != nil {
 		return nil, err
 	}
-	return contract.PerformUpkeep(opts, performData)
+	traced := *opts
+	traced.Context = ctx
+	var signed *types.Transaction
+	if opts.Signer != nil {
+		traced.Signer = func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			_, span := tracer.Start(ctx, "sign")
+			v, err := opts.Signer(from, tx)
+			endSpan(span, err)
+			signed = v
+			return v, err
+		}
+	}
+	tx, err = contract.PerformUpkeep(&traced, performData)
+	if err != nil && signed != nil && !opts.NoSend {
+		// signed but not sent
+		pool.ReleaseSpend(ctx, client.Network(), opts.From, signed)
+	}
+	return tx, err
 }
@@ -0,0 +1,84 @@
+package limit_keeper
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hibiken/asynq"
+)
+
+// Decoded is the content of a limit order task, as seen by its handler.
+type Decoded struct {
+	Type                        string
+	NetworkName                 string
+	AutomationCompatibleAddress common.Address
+	Keeper                      common.Address
+	// the payload of the task
+	Payload interface{}
+	// packed with the treasury of the context
+	OrderData []byte
+}
+
+// DecodeTask decodes t like DecodeTaskContext, without a treasury
+func DecodeTask(t *asynq.Task) (*Decoded, error) {
+	return DecodeTaskContext(context.Background(), t)
+}
+
+// DecodeTaskContext decodes t, packing its OrderData with the treasury of ctx like the handlers
+func DecodeTaskContext(ctx context.Context, t *asynq.Task) (*Decoded, error) {
+	var (
+		d   = &Decoded{Type: t.Type()}
+		err error
+	)
+	switch t.Type() {
+	case tasks.ACT_LIMIT_ORDER:
+		p, perr := parsePayloadFrom(t)
+		if perr != nil {
+			return nil, perr
+		}
+		d.NetworkName, d.AutomationCompatibleAddress, d.Keeper, d.Payload = p.NetworkName, p.AutomationCompatibleAddress, p.Keeper, p
+		d.OrderData, err = p.orderData(ctx)
+	case tasks.ACT_TWAP_ORDER:
+		p, perr := parseTWAPPayloadFrom(t)
+		if perr != nil {
+			return nil, perr
+		}
+		d.NetworkName, d.AutomationCompatibleAddress, d.Keeper, d.Payload = p.NetworkName, p.AutomationCompatibleAddress, p.Keeper, p
+		// the slice executed by the task
+		slice, serr := p.slice()
+		if serr != nil {
+			return nil, fmt.Errorf("slice %d of %d: %w", p.Slice, p.Slices, serr)
+		}
+		d.OrderData, err = slice.orderData(ctx)
+	case tasks.ACT_CANCEL_LIMIT_ORDER:
+		p, perr := parseCancelPayloadFrom(t)
+		if perr != nil {
+			return nil, perr
+		}
+		d.NetworkName, d.AutomationCompatibleAddress, d.Keeper, d.Payload = p.NetworkName, p.AutomationCompatibleAddress, p.Keeper, p
+		d.OrderData, err = p.orderData(ctx)
+	default:
+		return nil, fmt.Errorf("unknown task type %s", t.Type())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pack order data error: %w", err)
+	}
+	return d, nil
+}
+
+// CheckTask runs the checkUpkeep of t against client, without sending any transaction
+func CheckTask(ctx context.Context, client eclient.Ethclient, t *asynq.Task) (bool, error) {
+	d, err := DecodeTaskContext(ctx, t)
+	if err != nil {
+		return false, err
+	}
+	callable, _, err := checkUpkeep(ctx, client, &bind.CallOpts{
+		Context: ctx,
+		From:    d.Keeper,
+	}, d.AutomationCompatibleAddress, d.OrderData)
+	return callable, err
+}
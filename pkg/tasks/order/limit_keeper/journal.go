@@ -0,0 +1,206 @@
+package limit_keeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/pool"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/redis/go-redis/v9"
+	"github.com/tinkler/moonmist/pkg/jsonz/cjson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// JournalEntry records the transactions sent for an order before they are broadcast.
+type JournalEntry struct {
+	Keeper   common.Address
+	Nonce    uint64
+	TxHashes []common.Hash
+}
+
+// Journal keeps the executions in flight, so a redelivered task resumes waiting for its transaction
+type Journal interface {
+	// Load returns nil without error when key is absent
+	Load(ctx context.Context, key string) (*JournalEntry, error)
+	Save(ctx context.Context, key string, entry *JournalEntry) error
+	Delete(ctx context.Context, key string) error
+}
+
+type journalKey struct{}
+
+func WithJournal(ctx context.Context, journal Journal) context.Context {
+	return context.WithValue(ctx, journalKey{}, journal)
+}
+
+// JournalKeyOf keys the execution and the cancel of an order apart, as TaskID does
+func JournalKeyOf(networkName string, automationCompatibleAddress common.Address, o order.Order, cancel bool) string {
+	return TaskID(networkName, automationCompatibleAddress, o, cancel)
+}
+
+type MemoryJournal struct {
+	entries sync.Map
+}
+
+func NewMemoryJournal() *MemoryJournal {
+	return &MemoryJournal{}
+}
+
+func (j *MemoryJournal) Load(ctx context.Context, key string) (*JournalEntry, error) {
+	v, ok := j.entries.Load(key)
+	if !ok {
+		return nil, nil
+	}
+	entry := *v.(*JournalEntry)
+	entry.TxHashes = append([]common.Hash(nil), entry.TxHashes...)
+	return &entry, nil
+}
+
+func (j *MemoryJournal) Save(ctx context.Context, key string, entry *JournalEntry) error {
+	saved := *entry
+	saved.TxHashes = append([]common.Hash(nil), entry.TxHashes...)
+	j.entries.Store(key, &saved)
+	return nil
+}
+
+func (j *MemoryJournal) Delete(ctx context.Context, key string) error {
+	j.entries.Delete(key)
+	return nil
+}
+
+// RedisJournal survives the worker crashes, entries expire after ttl.
+type RedisJournal struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func NewRedisJournal(client redis.UniversalClient, prefix string, ttl time.Duration) *RedisJournal {
+	if prefix == "" {
+		prefix = "wetask:journal:"
+	}
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &RedisJournal{client: client, prefix: prefix, ttl: ttl}
+}
+
+func (j *RedisJournal) Load(ctx context.Context, key string) (*JournalEntry, error) {
+	data, err := j.client.Get(ctx, j.prefix+key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entry JournalEntry
+	if err := cjson.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (j *RedisJournal) Save(ctx context.Context, key string, entry *JournalEntry) error {
+	data, err := cjson.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return j.client.Set(ctx, j.prefix+key, data, j.ttl).Err()
+}
+
+func (j *RedisJournal) Delete(ctx context.Context, key string) error {
+	return j.client.Del(ctx, j.prefix+key).Err()
+}
+
+// journaled is the journal of one execution, a no-op without a Journal in the context
+type journaled struct {
+	journal Journal
+	key     string
+	entry   *JournalEntry
+}
+
+func openJournal(ctx context.Context, networkName string, automationCompatibleAddress common.Address, o order.Order, cancel bool) *journaled {
+	journal, _ := ctx.Value(journalKey{}).(Journal)
+	return &journaled{journal: journal, key: JournalKeyOf(networkName, automationCompatibleAddress, o, cancel)}
+}
+
+// resume waits for the transactions recorded by a previous delivery of the task
+func (j *journaled) resume(ctx context.Context, client eclient.Ethclient, r *Result) (receipt *types.Receipt, resumed bool, err error) {
+	if j.journal == nil {
+		return nil, false, nil
+	}
+	entry, err := j.journal.Load(ctx, j.key)
+	if err != nil {
+		return nil, true, fmt.Errorf("load journal %s error: %w", j.key, err)
+	}
+	if entry == nil || len(entry.TxHashes) == 0 {
+		return nil, false, nil
+	}
+	receipt, err = client.ResumeReceipt(ctx, entry.TxHashes)
+	if errors.Is(err, ethereum.NotFound) {
+		// dropped by the node, execute again
+		pool.Logger(ctx).Warn("journaled transactions dropped, executing again", slog.Any("txs", entry.TxHashes))
+		_ = j.journal.Delete(ctx, j.key)
+		return nil, false, nil
+	}
+	pool.Logger(ctx).Info("resumed journaled transactions", slog.Any("txs", entry.TxHashes), slog.Uint64("nonce", entry.Nonce))
+	j.entry = entry
+	r.Resumed = true
+	r.Nonce = &entry.Nonce
+	r.TxHashes = append(r.TxHashes, entry.TxHashes...)
+	j.close(ctx, err)
+	return receipt, true, err
+}
+
+// performUpkeep journals the signed transaction before broadcasting it
+func (j *journaled) performUpkeep(ctx context.Context, client eclient.Ethclient, opts *bind.TransactOpts, automationCompatibleAddress common.Address, performData []byte) (*types.Transaction, error) {
+	if j.journal == nil {
+		return performUpkeep(ctx, client, opts, automationCompatibleAddress, performData)
+	}
+	noSend := *opts
+	noSend.NoSend = true
+	tx, err := performUpkeep(ctx, client, &noSend, automationCompatibleAddress, performData)
+	if err != nil {
+		return nil, err
+	}
+	if j.entry == nil || j.entry.Nonce != tx.Nonce() {
+		j.entry = &JournalEntry{Keeper: opts.From, Nonce: tx.Nonce()}
+	}
+	j.entry.TxHashes = append(j.entry.TxHashes, tx.Hash())
+	if err := j.journal.Save(ctx, j.key, j.entry); err != nil {
+		pool.ReleaseSpend(ctx, client.Network(), opts.From, tx)
+		return nil, fmt.Errorf("save journal %s error: %w", j.key, err)
+	}
+	backend, err := client.GetClient(ctx)
+	if err != nil {
+		pool.ReleaseSpend(ctx, client.Network(), opts.From, tx)
+		return nil, err
+	}
+	ctx, span := tracer.Start(ctx, "sendTransaction", trace.WithAttributes(attribute.String("wetask.tx_hash", tx.Hash().Hex())))
+	err = backend.SendTransaction(ctx, tx)
+	endSpan(span, err)
+	if err != nil {
+		pool.ReleaseSpend(ctx, client.Network(), opts.From, tx)
+		return nil, err
+	}
+	return tx, nil
+}
+
+// close forgets the execution once its outcome is known on chain
+func (j *journaled) close(ctx context.Context, err error) {
+	if j.journal == nil {
+		return
+	}
+	if err == nil || errors.Is(err, eclient.ErrTransactionReverted) {
+		_ = j.journal.Delete(ctx, j.key)
+	}
+}
@@ -0,0 +1,109 @@
+package limit_keeper
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type resumeClient struct {
+	receipts map[common.Hash]*types.Receipt
+	resumed  [][]common.Hash
+}
+
+func (c *resumeClient) ChainID(ctx context.Context) (*big.Int, error) { return big.NewInt(1), nil }
+
+func (c *resumeClient) Network() string { return "sepolia" }
+
+func (c *resumeClient) GetClient(ctx context.Context) (bind.ContractBackend, error) {
+	return nil, ethereum.NotFound
+}
+
+func (c *resumeClient) WaitForReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return nil, ethereum.NotFound
+}
+
+func (c *resumeClient) UrgeReceipt(ctx context.Context, send func() (common.Hash, error), maxIncreaseTimes int) (*types.Receipt, error) {
+	return nil, ethereum.NotFound
+}
+
+func (c *resumeClient) ResumeReceipt(ctx context.Context, txHashes []common.Hash) (*types.Receipt, error) {
+	c.resumed = append(c.resumed, txHashes)
+	for _, h := range txHashes {
+		if receipt, ok := c.receipts[h]; ok {
+			return receipt, nil
+		}
+	}
+	return nil, ethereum.NotFound
+}
+
+func TestJournaled_Resume(t *testing.T) {
+	contract := common.HexToAddress("0xc0ffee")
+	o := order.Order{Account: common.HexToAddress("0x1111"), Index: big.NewInt(3)}
+	key := JournalKeyOf("sepolia", contract, o, false)
+	mined := common.HexToHash("0x02")
+
+	t.Run("without journal", func(t *testing.T) {
+		client := &resumeClient{}
+		_, resumed, err := openJournal(context.Background(), "sepolia", contract, o, false).resume(context.Background(), client, new(Result))
+		assert.NoError(t, err)
+		assert.False(t, resumed)
+		assert.Empty(t, client.resumed)
+	})
+
+	t.Run("nothing recorded", func(t *testing.T) {
+		ctx := WithJournal(context.Background(), NewMemoryJournal())
+		_, resumed, err := openJournal(ctx, "sepolia", contract, o, false).resume(ctx, &resumeClient{}, new(Result))
+		assert.NoError(t, err)
+		assert.False(t, resumed)
+	})
+
+	t.Run("recorded transaction mined", func(t *testing.T) {
+		journal := NewMemoryJournal()
+		ctx := WithJournal(context.Background(), journal)
+		entry := &JournalEntry{Keeper: common.HexToAddress("0x1234"), Nonce: 9, TxHashes: []common.Hash{common.HexToHash("0x01"), mined}}
+		assert.NoError(t, journal.Save(ctx, key, entry))
+
+		client := &resumeClient{receipts: map[common.Hash]*types.Receipt{mined: {TxHash: mined, Status: types.ReceiptStatusSuccessful}}}
+		r := new(Result)
+		receipt, resumed, err := openJournal(ctx, "sepolia", contract, o, false).resume(ctx, client, r)
+		assert.NoError(t, err)
+		assert.True(t, resumed)
+		assert.Equal(t, mined, receipt.TxHash)
+		assert.True(t, r.Resumed)
+		assert.Equal(t, uint64(9), *r.Nonce)
+		assert.Equal(t, entry.TxHashes, r.TxHashes)
+
+		// the execution is done
+		left, err := journal.Load(ctx, key)
+		assert.NoError(t, err)
+		assert.Nil(t, left)
+	})
+
+	t.Run("recorded transaction dropped", func(t *testing.T) {
+		journal := NewMemoryJournal()
+		ctx := WithJournal(context.Background(), journal)
+		assert.NoError(t, journal.Save(ctx, key, &JournalEntry{Nonce: 9, TxHashes: []common.Hash{common.HexToHash("0x01")}}))
+
+		_, resumed, err := openJournal(ctx, "sepolia", contract, o, false).resume(ctx, &resumeClient{}, new(Result))
+		assert.NoError(t, err)
+		assert.False(t, resumed)
+		left, _ := journal.Load(ctx, key)
+		assert.Nil(t, left)
+	})
+
+	t.Run("keyed by order", func(t *testing.T) {
+		other := o
+		other.Index = big.NewInt(4)
+		assert.NotEqual(t, key, JournalKeyOf("sepolia", contract, other, false))
+		assert.NotEqual(t, key, JournalKeyOf("mainnet", contract, o, false))
+		assert.NotEqual(t, key, JournalKeyOf("sepolia", contract, o, true))
+	})
+}
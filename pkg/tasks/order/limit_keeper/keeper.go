@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/WEPublicGoods/wetask/pkg/metrics"
 	"github.com/ethereum/go-ethereum/common"
 )
 
@@ -28,11 +29,8 @@ func (k *keeper) GetNonce(ctx context.Context, backend backend) (uint64, func(),
 		nonce := k.currentNonce + 1
 		k.currentNonce = nonce
 		k.activeCount++
-		return nonce, func() {
-			k.mu.Lock()
-			k.activeCount--
-			k.mu.Unlock()
-		}, nil
+		metrics.SetInflightNonces(k.address, k.activeCount)
+		return nonce, k.release, nil
 	}
 
 	// Get fresh nonce from blockchain
@@ -43,9 +41,13 @@ func (k *keeper) GetNonce(ctx context.Context, backend backend) (uint64, func(),
 
 	k.currentNonce = nonce
 	k.activeCount++
-	return nonce, func() {
-		k.mu.Lock()
-		k.activeCount--
-		k.mu.Unlock()
-	}, nil
+	metrics.SetInflightNonces(k.address, k.activeCount)
+	return nonce, k.release, nil
+}
+
+func (k *keeper) release() {
+	k.mu.Lock()
+	k.activeCount--
+	metrics.SetInflightNonces(k.address, k.activeCount)
+	k.mu.Unlock()
 }
@@ -1,15 +1,24 @@
 package limit_keeper
 
 import (
+	"context"
 	"fmt"
 	"math/big"
+	"time"
 
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
 	"github.com/hibiken/asynq"
 )
 
 type (
 	basefeeWiggleMultiplierOption big.Int
 	gasLimitMultiplierOption      float64
+	callbackOption                string
+	traceOption                   map[string]string
+	allowUnknownOrderTypeOption   bool
+	priceTriggerOption            order.Trigger
+	expiryOption                  time.Time
 )
 
 func (n basefeeWiggleMultiplierOption) String() string {
@@ -43,3 +52,66 @@ func GasLimitMultiplier(n float64) asynq.Option {
 	}
 	return gasLimitMultiplierOption(n)
 }
+
+func (n callbackOption) String() string {
+	return fmt.Sprintf("Callback(%q)", string(n))
+}
+
+func (n callbackOption) Type() asynq.OptionType { return asynq.OptionType(12) }
+
+func (n callbackOption) Value() interface{} { return string(n) }
+
+// the url notified with the result once the task is done
+func Callback(url string) asynq.Option {
+	return callbackOption(url)
+}
+
+func (n traceOption) String() string {
+	return fmt.Sprintf("Trace(%v)", map[string]string(n))
+}
+
+func (n traceOption) Type() asynq.OptionType { return asynq.OptionType(13) }
+
+func (n traceOption) Value() interface{} { return map[string]string(n) }
+
+// Trace carries the trace context of ctx in the payload
+func Trace(ctx context.Context) asynq.Option {
+	return traceOption(tasks.InjectTrace(ctx))
+}
+
+func (n allowUnknownOrderTypeOption) String() string { return "AllowUnknownOrderType()" }
+
+func (n allowUnknownOrderTypeOption) Type() asynq.OptionType { return asynq.OptionType(14) }
+
+func (n allowUnknownOrderTypeOption) Value() interface{} { return bool(n) }
+
+// AllowUnknownOrderType lets NewNormalTask enqueue an order type which is not registered
+func AllowUnknownOrderType() asynq.Option {
+	return allowUnknownOrderTypeOption(true)
+}
+
+func (n priceTriggerOption) String() string {
+	return fmt.Sprintf("PriceTrigger(%s %s)", n.Source, n.Feed.Hex())
+}
+
+func (n priceTriggerOption) Type() asynq.OptionType { return asynq.OptionType(15) }
+
+func (n priceTriggerOption) Value() interface{} { return order.Trigger(n) }
+
+// PriceTrigger holds the execution until the price of the feed crosses the threshold of trigger
+func PriceTrigger(trigger order.Trigger) asynq.Option {
+	return priceTriggerOption(trigger)
+}
+
+func (n expiryOption) String() string {
+	return fmt.Sprintf("Expiry(%s)", time.Time(n).UTC().Format(time.RFC3339))
+}
+
+func (n expiryOption) Type() asynq.OptionType { return asynq.OptionType(16) }
+
+func (n expiryOption) Value() interface{} { return time.Time(n) }
+
+// Expiry is when the order expires, compared with the timestamp of the latest block
+func Expiry(expiry time.Time) asynq.Option {
+	return expiryOption(expiry)
+}
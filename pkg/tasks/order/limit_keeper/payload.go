@@ -1,6 +1,8 @@
 package limit_keeper
 
 import (
+	"context"
+	"fmt"
 	"math/big"
 
 	"github.com/WEPublicGoods/wetask/pkg/eth/order"
@@ -14,6 +16,13 @@ type payload struct {
 	LimitOrder                  order.LimitOrderExecuteInput
 	BasefeeWiggleMultiplier     *big.Int
 	GasLimitMultiplier          float64
+	CallbackURL                 string
+	// the execution waits for the price to cross the trigger
+	Trigger *order.Trigger `json:"trigger,omitempty"`
+	// the unix time the order expires at
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+	// the trace context of the enqueuer
+	Trace map[string]string `json:"trace,omitempty"`
 }
 
 type cancelPayload struct {
@@ -21,4 +30,50 @@ type cancelPayload struct {
 	AutomationCompatibleAddress common.Address
 	Keeper                      common.Address
 	Order                       order.Order
+	CallbackURL                 string
+	ExpiresAt                   int64             `json:"expiresAt,omitempty"`
+	Trace                       map[string]string `json:"trace,omitempty"`
+}
+
+type treasuryKey struct {
+	networkName string
+}
+
+// WithTreasury pays the execute fees on networkName to treasury
+func WithTreasury(ctx context.Context, networkName string, treasury common.Address) context.Context {
+	return context.WithValue(ctx, treasuryKey{networkName}, treasury)
+}
+
+// feeReceiver is the treasury of the network, or the fee receiver of the order falling back to the keeper
+func feeReceiver(ctx context.Context, networkName string, requested, keeper common.Address) common.Address {
+	if treasury, ok := ctx.Value(treasuryKey{networkName}).(common.Address); ok {
+		return treasury
+	}
+	if requested != (common.Address{}) {
+		return requested
+	}
+	return keeper
+}
+
+// orderData is the data checked and performed by the handlers
+func (p *payload) orderData(ctx context.Context) ([]byte, error) {
+	in := p.LimitOrder
+	in.Routes = append([]order.SwapRoute(nil), p.LimitOrder.Routes...)
+	if err := in.Build(); err != nil {
+		return nil, fmt.Errorf("build %s order: %w", in.Order.TypeName(), err)
+	}
+	in.FeeReceiver = feeReceiver(ctx, p.NetworkName, p.LimitOrder.FeeReceiver, p.Keeper)
+	return in.Pack(false)
+}
+
+func (p *cancelPayload) orderData(ctx context.Context) ([]byte, error) {
+	in := order.LimitOrderExecuteInput{
+		Order:             p.Order,
+		RemainingAmountIn: big.NewInt(0),
+		AmountIn:          big.NewInt(0),
+		AmountOutMin:      big.NewInt(0),
+		AmountOutExpected: big.NewInt(0),
+		FeeReceiver:       feeReceiver(ctx, p.NetworkName, common.Address{}, p.Keeper),
+	}
+	return in.Pack(true)
 }
@@ -0,0 +1,68 @@
+package limit_keeper
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	ethorder "github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayload_FeeReceiver(t *testing.T) {
+	keeper := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	receiver := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	treasury := common.HexToAddress("0x4444444444444444444444444444444444444444")
+	input := ethorder.LimitOrderExecuteInput{
+		Order: ethorder.Order{
+			Account:    common.HexToAddress("0x1111111111111111111111111111111111111111"),
+			Index:      big.NewInt(1),
+			OrderType:  big.NewInt(0),
+			ExecuteFee: big.NewInt(100),
+		},
+		TokenIn:           common.HexToAddress("0x6666666666666666666666666666666666666666"),
+		TokenOut:          common.HexToAddress("0x7777777777777777777777777777777777777777"),
+		RemainingAmountIn: big.NewInt(1000),
+		Routes: []ethorder.SwapRoute{{
+			TokenIn:      common.HexToAddress("0x6666666666666666666666666666666666666666"),
+			TokenOut:     common.HexToAddress("0x7777777777777777777777777777777777777777"),
+			AmountIn:     big.NewInt(1000),
+			AmountOutMin: big.NewInt(900),
+		}},
+		AmountIn:          big.NewInt(1000),
+		AmountOutMin:      big.NewInt(900),
+		AmountOutExpected: big.NewInt(950),
+	}
+	packedFeeReceiver := func(t *testing.T, ctx context.Context, p interface {
+		orderData(context.Context) ([]byte, error)
+	}) common.Address {
+		data, err := p.orderData(ctx)
+		assert.NoError(t, err)
+		decoded, _, err := ethorder.DecodeLimitOrderExecuteInput(data)
+		assert.NoError(t, err)
+		return decoded.FeeReceiver
+	}
+	withTreasury := WithTreasury(context.Background(), "sepolia", treasury)
+
+	p := &payload{NetworkName: "sepolia", Keeper: keeper, LimitOrder: input}
+	assert.Equal(t, keeper, packedFeeReceiver(t, context.Background(), p))
+	assert.Equal(t, treasury, packedFeeReceiver(t, withTreasury, p))
+	p.LimitOrder.FeeReceiver = receiver
+	assert.Equal(t, receiver, packedFeeReceiver(t, context.Background(), p))
+	assert.Equal(t, treasury, packedFeeReceiver(t, withTreasury, p))
+	// the treasury is per network
+	p.NetworkName = "mainnet"
+	assert.Equal(t, receiver, packedFeeReceiver(t, withTreasury, p))
+
+	cp := &cancelPayload{NetworkName: "sepolia", Keeper: keeper, Order: input.Order}
+	assert.Equal(t, keeper, packedFeeReceiver(t, context.Background(), cp))
+	assert.Equal(t, treasury, packedFeeReceiver(t, withTreasury, cp))
+
+	contract := "0x5555555555555555555555555555555555555555"
+	_, err := NewNormalTask("sepolia", contract, keeper.Hex(), p.LimitOrder)
+	assert.NoError(t, err)
+	p.LimitOrder.FeeReceiver = common.HexToAddress(contract)
+	_, err = NewNormalTask("sepolia", contract, keeper.Hex(), p.LimitOrder)
+	assert.Error(t, err)
+}
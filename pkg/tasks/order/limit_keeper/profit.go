@@ -0,0 +1,129 @@
+package limit_keeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hibiken/asynq"
+)
+
+var ErrUnprofitable = errors.New("unprofitable")
+
+// UnprofitableError reports a gas cost, in the fee token, above the order's execute fee.
+type UnprofitableError struct {
+	Cost       *big.Int
+	ExecuteFee *big.Int
+}
+
+func (e *UnprofitableError) Error() string {
+	return fmt.Sprintf("gas cost %s exceeds execute fee %s", e.Cost, e.ExecuteFee)
+}
+
+func (e *UnprofitableError) Unwrap() error { return ErrUnprofitable }
+
+// PriceSource converts an amount of the native token into the token the execute fee is paid in.
+type PriceSource interface {
+	Quote(ctx context.Context, networkName string, nativeAmount *big.Int) (*big.Int, error)
+}
+
+type ProfitPolicy struct {
+	// nil if the execute fee is paid in the native token
+	PriceSource PriceSource
+	// extra margin required on top of the gas cost, in basis points
+	MarginBps uint64
+	// defer unprofitable orders by RetryIn instead of dropping them
+	RetryIn time.Duration
+}
+
+type profitPolicyKey struct {
+	networkName string
+}
+
+// WithProfitPolicy guards the executions on networkName with policy
+func WithProfitPolicy(ctx context.Context, networkName string, policy ProfitPolicy) context.Context {
+	return context.WithValue(ctx, profitPolicyKey{networkName}, &policy)
+}
+
+func getProfitPolicy(ctx context.Context, networkName string) (*ProfitPolicy, bool) {
+	policy, ok := ctx.Value(profitPolicyKey{networkName}).(*ProfitPolicy)
+	return policy, ok
+}
+
+// checkProfit compares gasLimit * gasFeeCap with executeFee
+func checkProfit(ctx context.Context, networkName string, executeFee *big.Int, gasLimit uint64, gasFeeCap *big.Int) error {
+	policy, ok := getProfitPolicy(ctx, networkName)
+	if !ok {
+		return nil
+	}
+	if executeFee == nil {
+		executeFee = new(big.Int)
+	}
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(gasLimit), gasFeeCap)
+	if policy.MarginBps > 0 {
+		cost.Mul(cost, new(big.Int).SetUint64(10000+policy.MarginBps))
+		cost.Quo(cost, big.NewInt(10000))
+	}
+	if policy.PriceSource != nil {
+		var err error
+		cost, err = policy.PriceSource.Quote(ctx, networkName, cost)
+		if err != nil {
+			return fmt.Errorf("quote gas cost error: %w", err)
+		}
+	}
+	if executeFee.Cmp(cost) >= 0 {
+		return nil
+	}
+	uerr := &UnprofitableError{Cost: cost, ExecuteFee: executeFee}
+	if policy.RetryIn > 0 {
+		return tasks.Defer(uerr, policy.RetryIn)
+	}
+	return fmt.Errorf("%w, %w", uerr, asynq.SkipRetry)
+}
+
+// estimateProfit checks the cost the transaction would have if it was sent with transactOpts
+func estimateProfit(ctx context.Context, networkName string, executeFee *big.Int, backend bind.ContractBackend, automationCompatibleAddress *common.Address, transactOpts *bind.TransactOpts, input []byte) error {
+	gasTipCap, gasFeeCap := transactOpts.GasTipCap, transactOpts.GasFeeCap
+	if gasFeeCap == nil {
+		head, err := backend.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if head.BaseFee == nil {
+			gasFeeCap, err = backend.SuggestGasPrice(ctx)
+			if err != nil {
+				return err
+			}
+		} else {
+			if gasTipCap == nil {
+				gasTipCap, err = backend.SuggestGasTipCap(ctx)
+				if err != nil {
+					return err
+				}
+			}
+			gasFeeCap = new(big.Int).Add(gasTipCap, new(big.Int).Mul(head.BaseFee, big.NewInt(2)))
+		}
+	}
+	gasLimit := transactOpts.GasLimit
+	if gasLimit == 0 {
+		var err error
+		gasLimit, err = estimateGas(ctx, backend, ethereum.CallMsg{
+			From:      transactOpts.From,
+			To:        automationCompatibleAddress,
+			GasTipCap: gasTipCap,
+			GasFeeCap: gasFeeCap,
+			Value:     transactOpts.Value,
+			Data:      input,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return checkProfit(ctx, networkName, executeFee, gasLimit, gasFeeCap)
+}
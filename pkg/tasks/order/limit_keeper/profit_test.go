@@ -0,0 +1,69 @@
+package limit_keeper
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+)
+
+type fixedPriceSource struct {
+	num, den int64
+}
+
+func (s fixedPriceSource) Quote(ctx context.Context, networkName string, nativeAmount *big.Int) (*big.Int, error) {
+	v := new(big.Int).Mul(nativeAmount, big.NewInt(s.num))
+	return v.Quo(v, big.NewInt(s.den)), nil
+}
+
+func TestCheckProfit(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("no policy", func(t *testing.T) {
+		err := checkProfit(ctx, "sepolia", big.NewInt(0), 100000, big.NewInt(1e9))
+		assert.NoError(t, err)
+	})
+
+	t.Run("native fee", func(t *testing.T) {
+		ctx := WithProfitPolicy(ctx, "sepolia", ProfitPolicy{})
+		assert.NoError(t, checkProfit(ctx, "sepolia", big.NewInt(1e14), 100000, big.NewInt(1e9)))
+
+		err := checkProfit(ctx, "sepolia", big.NewInt(1e14-1), 100000, big.NewInt(1e9))
+		assert.ErrorIs(t, err, ErrUnprofitable)
+		assert.ErrorIs(t, err, asynq.SkipRetry)
+		var uerr *UnprofitableError
+		assert.True(t, errors.As(err, &uerr))
+		assert.Equal(t, big.NewInt(1e14), uerr.Cost)
+	})
+
+	t.Run("margin", func(t *testing.T) {
+		ctx := WithProfitPolicy(ctx, "sepolia", ProfitPolicy{MarginBps: 5000})
+		assert.ErrorIs(t, checkProfit(ctx, "sepolia", big.NewInt(1e14), 100000, big.NewInt(1e9)), ErrUnprofitable)
+		assert.NoError(t, checkProfit(ctx, "sepolia", big.NewInt(15e13), 100000, big.NewInt(1e9)))
+	})
+
+	t.Run("price source", func(t *testing.T) {
+		// 1 native = 2000 fee token
+		ctx := WithProfitPolicy(ctx, "sepolia", ProfitPolicy{PriceSource: fixedPriceSource{2000, 1}})
+		assert.NoError(t, checkProfit(ctx, "sepolia", big.NewInt(2e17), 100000, big.NewInt(1e9)))
+		assert.ErrorIs(t, checkProfit(ctx, "sepolia", big.NewInt(1e17), 100000, big.NewInt(1e9)), ErrUnprofitable)
+	})
+
+	t.Run("defer", func(t *testing.T) {
+		ctx := WithProfitPolicy(ctx, "sepolia", ProfitPolicy{RetryIn: time.Minute})
+		err := checkProfit(ctx, "sepolia", big.NewInt(0), 100000, big.NewInt(1e9))
+		assert.ErrorIs(t, err, ErrUnprofitable)
+		assert.NotErrorIs(t, err, asynq.SkipRetry)
+		assert.Equal(t, time.Minute, tasks.RetryDelay(0, err, nil))
+	})
+
+	t.Run("other network", func(t *testing.T) {
+		ctx := WithProfitPolicy(ctx, "mainnet", ProfitPolicy{})
+		assert.NoError(t, checkProfit(ctx, "sepolia", big.NewInt(0), 100000, big.NewInt(1e9)))
+	})
+}
@@ -0,0 +1,303 @@
+package limit_keeper
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/metrics"
+	"github.com/WEPublicGoods/wetask/pkg/notify"
+	"github.com/WEPublicGoods/wetask/pkg/pool"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hibiken/asynq"
+	"github.com/tinkler/moonmist/pkg/jsonz/cjson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Outcome string
+
+const (
+	OutcomeExecuted     Outcome = "executed"
+	OutcomeNotCallable  Outcome = "not_callable"
+	OutcomeReverted     Outcome = "reverted"
+	OutcomeUnprofitable Outcome = "unprofitable"
+	OutcomeDeferred     Outcome = "deferred"
+	OutcomeWaiting      Outcome = "waiting"
+	OutcomeExpired      Outcome = "expired"
+	OutcomeFailed       Outcome = "failed"
+)
+
+type ReceiptSummary struct {
+	TxHash            common.Hash
+	Status            uint64
+	BlockNumber       *big.Int
+	BlockHash         common.Hash
+	GasUsed           uint64
+	EffectiveGasPrice *big.Int
+}
+
+// Result is written through the task's ResultWriter, read it back with ParseResult
+type Result struct {
+	Outcome                     Outcome
+	Cancel                      bool
+	NetworkName                 string
+	AutomationCompatibleAddress common.Address
+	Keeper                      common.Address
+	Order                       order.Order
+	// the identity of the order for the callers
+	OrderKey  string
+	OrderHash common.Hash
+	Nonce     *uint64
+	// waited for the transactions of a previous delivery
+	Resumed bool
+	// every transaction sent, replacements included
+	TxHashes []common.Hash
+	Receipt  *ReceiptSummary
+	// decoded from the receipt of an executed order, nil if the event is not found
+	Fill *order.Fill
+	// the progress of a TWAP order
+	Slice *SliceProgress
+	Error string
+
+	callbackURL string
+	// when the first transaction was sent by this delivery
+	sentAt time.Time
+	span   trace.Span
+	logger *slog.Logger
+}
+
+func ParseResult(data []byte) (*Result, error) {
+	var r Result
+	if err := cjson.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (r *Result) sent(ctx context.Context, tx *types.Transaction) {
+	if r.Nonce == nil {
+		nonce := tx.Nonce()
+		r.Nonce = &nonce
+	}
+	if r.sentAt.IsZero() {
+		r.sentAt = time.Now()
+	}
+	r.TxHashes = append(r.TxHashes, tx.Hash())
+	msg := "transaction sent"
+	if len(r.TxHashes) > 1 {
+		msg = "replacement sent"
+	}
+	pool.Logger(ctx).Info(msg,
+		slog.String("tx", tx.Hash().Hex()),
+		slog.Uint64("nonce", tx.Nonce()),
+		slog.Any("gasFeeCap", tx.GasFeeCap()),
+		slog.Any("gasTipCap", tx.GasTipCap()),
+		slog.Uint64("gasLimit", tx.Gas()),
+	)
+	if r.span != nil {
+		r.span.AddEvent("sent", trace.WithAttributes(
+			attribute.String("wetask.tx_hash", tx.Hash().Hex()),
+			attribute.Int64("wetask.nonce", int64(tx.Nonce())),
+		))
+	}
+}
+
+func (r *Result) confirmed(receipt *types.Receipt) {
+	if receipt == nil {
+		return
+	}
+	r.Receipt = &ReceiptSummary{
+		TxHash:            receipt.TxHash,
+		Status:            receipt.Status,
+		BlockNumber:       receipt.BlockNumber,
+		BlockHash:         receipt.BlockHash,
+		GasUsed:           receipt.GasUsed,
+		EffectiveGasPrice: receipt.EffectiveGasPrice,
+	}
+	if !r.sentAt.IsZero() {
+		metrics.ObserveInclusion(r.NetworkName, time.Since(r.sentAt))
+	}
+	metrics.ObserveGas(r.NetworkName, r.Keeper, receipt.GasUsed, receipt.EffectiveGasPrice)
+}
+
+type fillDecoderKey struct {
+	networkName string
+}
+
+// WithFillDecoder decodes the fills on networkName with decoder instead of order.DefaultFillDecoder
+func WithFillDecoder(ctx context.Context, networkName string, decoder *order.FillDecoder) context.Context {
+	return context.WithValue(ctx, fillDecoderKey{networkName}, decoder)
+}
+
+func (r *Result) decodeFill(ctx context.Context, receipt *types.Receipt, input *order.LimitOrderExecuteInput) {
+	decoder, ok := ctx.Value(fillDecoderKey{r.NetworkName}).(*order.FillDecoder)
+	if !ok {
+		decoder = order.DefaultFillDecoder()
+	}
+	// an executed order without the event leaves the fill unknown
+	r.Fill, _ = decoder.Decode(receipt, r.AutomationCompatibleAddress, input.Order, input.RemainingAmountIn)
+}
+
+type notifierKey struct{}
+
+// WithNotifier delivers the results of the tasks created with a Callback
+func WithNotifier(ctx context.Context, notifier notify.Notifier) context.Context {
+	return context.WithValue(ctx, notifierKey{}, notifier)
+}
+
+// report writes the result of t and notifies the callback when the task won't run again
+func (r *Result) report(ctx context.Context, t *asynq.Task, err error) error {
+	switch {
+	case err != nil:
+		r.Error = err.Error()
+		var de *tasks.DeferError
+		switch {
+		case errors.Is(err, ErrUnprofitable):
+			r.Outcome = OutcomeUnprofitable
+		case errors.Is(err, ErrTriggerNotCrossed), errors.Is(err, ErrNotExpired):
+			r.Outcome = OutcomeWaiting
+		case errors.As(err, &de):
+			r.Outcome = OutcomeDeferred
+		case errors.Is(err, eclient.ErrTransactionReverted):
+			r.Outcome = OutcomeReverted
+		default:
+			r.Outcome = OutcomeFailed
+		}
+	case r.Outcome == "":
+		r.Outcome = OutcomeExecuted
+	}
+	metrics.SetOutcome(ctx, string(r.Outcome))
+	r.endTask(err)
+	r.log(ctx, err)
+	if !r.sentAt.IsZero() {
+		metrics.ObserveFeeBumps(r.NetworkName, len(r.TxHashes)-1)
+	}
+	data, merr := cjson.Marshal(r)
+	if merr != nil {
+		return err
+	}
+	// the result is informative, never fail an executed order because of it
+	if w := t.ResultWriter(); w != nil {
+		_, _ = w.Write(data)
+	}
+	if notifier, ok := ctx.Value(notifierKey{}).(notify.Notifier); ok && r.callbackURL != "" && isFinal(ctx, err) {
+		r.notify(ctx, notifier, data)
+	}
+	return err
+}
+
+// NotifyTimeout bounds the delivery of a result, its retries included
+const NotifyTimeout = 2 * time.Minute
+
+// notifying tracks the deliveries in flight
+var notifying sync.WaitGroup
+
+// notify delivers data in the background, the task is not held by a slow callback
+func (r *Result) notify(ctx context.Context, notifier notify.Notifier, data []byte) {
+	logger := r.logger
+	if logger == nil {
+		logger = pool.Logger(ctx)
+	}
+	// deliver even when the task ran out of time
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), NotifyTimeout)
+	notifying.Add(1)
+	go func(callbackURL string) {
+		defer notifying.Done()
+		defer cancel()
+		if err := notifier.Notify(ctx, callbackURL, data); err != nil {
+			logger.Warn("callback not delivered", slog.String("callbackUrl", eclient.RedactURLs(callbackURL)), slog.String("error", eclient.RedactURLs(err.Error())))
+		}
+	}(r.callbackURL)
+}
+
+// WaitNotifications waits for the deliveries in flight until ctx is done
+func WaitNotifications(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		notifying.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// log logs the outcome, with the level of the attention it needs
+func (r *Result) log(ctx context.Context, err error) {
+	level := slog.LevelInfo
+	switch r.Outcome {
+	case OutcomeWaiting:
+		level = slog.LevelDebug
+	case OutcomeReverted, OutcomeUnprofitable:
+		level = slog.LevelWarn
+	case OutcomeFailed:
+		level = slog.LevelError
+	}
+	args := []any{slog.String("outcome", string(r.Outcome))}
+	if len(r.TxHashes) > 0 {
+		args = append(args, slog.Any("txs", r.TxHashes))
+	}
+	if r.Resumed {
+		args = append(args, slog.Bool("resumed", true))
+	}
+	if r.Slice != nil {
+		args = append(args, slog.Int("slice", r.Slice.Slice), slog.Int("slices", r.Slice.Slices))
+	}
+	if r.Receipt != nil {
+		args = append(args, slog.Any("block", r.Receipt.BlockNumber), slog.Uint64("gasUsed", r.Receipt.GasUsed))
+	}
+	if err != nil {
+		args = append(args, slog.String("error", eclient.RedactURLs(err.Error())))
+	}
+	logger := r.logger
+	if logger == nil {
+		logger = pool.Logger(ctx)
+	}
+	logger.Log(ctx, level, "task done", args...)
+}
+
+func isFinal(ctx context.Context, err error) bool {
+	if err == nil || errors.Is(err, asynq.SkipRetry) {
+		return true
+	}
+	retried, ok := asynq.GetRetryCount(ctx)
+	if !ok {
+		return true
+	}
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	return retried >= maxRetry
+}
+
+func (r *Result) setPayload(p *payload) {
+	r.NetworkName = p.NetworkName
+	r.AutomationCompatibleAddress = p.AutomationCompatibleAddress
+	r.Keeper = p.Keeper
+	r.setOrder(p.LimitOrder.Order)
+	r.callbackURL = p.CallbackURL
+}
+
+func (r *Result) setCancelPayload(p *cancelPayload) {
+	r.NetworkName = p.NetworkName
+	r.AutomationCompatibleAddress = p.AutomationCompatibleAddress
+	r.Keeper = p.Keeper
+	r.setOrder(p.Order)
+	r.callbackURL = p.CallbackURL
+}
+
+func (r *Result) setOrder(o order.Order) {
+	r.Order = o
+	r.OrderKey = o.Key()
+	// validated by the task constructors, a zero hash otherwise
+	r.OrderHash, _ = o.Hash()
+}
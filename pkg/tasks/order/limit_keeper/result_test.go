@@ -0,0 +1,149 @@
+package limit_keeper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/WEPublicGoods/wetask/pkg/pool"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+	"github.com/tinkler/moonmist/pkg/jsonz/cjson"
+)
+
+func TestResult_Report(t *testing.T) {
+	task := asynq.NewTask("test", nil)
+	cases := []struct {
+		name    string
+		outcome Outcome
+		err     error
+		want    Outcome
+	}{
+		{"executed", "", nil, OutcomeExecuted},
+		{"not callable", OutcomeNotCallable, nil, OutcomeNotCallable},
+		{"unprofitable", "", fmt.Errorf("%w, %w", &UnprofitableError{}, asynq.SkipRetry), OutcomeUnprofitable},
+		{"deferred", "", tasks.Defer(errors.New("over cap"), time.Minute), OutcomeDeferred},
+		{"reverted", "", fmt.Errorf("transaction failed, %w", eclient.ErrTransactionReverted), OutcomeReverted},
+		{"failed", "", errors.New("dial error"), OutcomeFailed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := &Result{Outcome: c.outcome}
+			err := r.report(context.Background(), task, c.err)
+			assert.Equal(t, c.err, err)
+			assert.Equal(t, c.want, r.Outcome)
+			if c.err != nil {
+				assert.Equal(t, c.err.Error(), r.Error)
+			}
+		})
+	}
+}
+
+func TestResult_Marshal(t *testing.T) {
+	r := &Result{
+		NetworkName: "sepolia",
+		Keeper:      common.HexToAddress("0x1234"),
+	}
+	tx := types.NewTx(&types.DynamicFeeTx{Nonce: 7, GasFeeCap: big.NewInt(1), GasTipCap: big.NewInt(1)})
+	r.sent(context.Background(), tx)
+	r.confirmed(&types.Receipt{
+		TxHash:            tx.Hash(),
+		Status:            types.ReceiptStatusSuccessful,
+		BlockNumber:       big.NewInt(100),
+		GasUsed:           21000,
+		EffectiveGasPrice: big.NewInt(1e9),
+	})
+	assert.NoError(t, r.report(context.Background(), asynq.NewTask("test", nil), nil))
+
+	data, err := cjson.Marshal(r)
+	assert.NoError(t, err)
+	parsed, err := ParseResult(data)
+	assert.NoError(t, err)
+	assert.Equal(t, OutcomeExecuted, parsed.Outcome)
+	assert.Equal(t, uint64(7), *parsed.Nonce)
+	assert.Equal(t, []common.Hash{tx.Hash()}, parsed.TxHashes)
+	assert.Equal(t, uint64(21000), parsed.Receipt.GasUsed)
+	assert.Equal(t, big.NewInt(1e9), parsed.Receipt.EffectiveGasPrice)
+	assert.Equal(t, r.Keeper, parsed.Keeper)
+}
+
+type recordNotifier struct {
+	mu     sync.Mutex
+	urls   []string
+	bodies [][]byte
+	err    error
+}
+
+func (n *recordNotifier) Notify(ctx context.Context, callbackURL string, body []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.urls = append(n.urls, callbackURL)
+	n.bodies = append(n.bodies, body)
+	return n.err
+}
+
+func TestResult_Notify(t *testing.T) {
+	task := asynq.NewTask("test", nil)
+	n := new(recordNotifier)
+	ctx := WithNotifier(context.Background(), n)
+
+	r := &Result{Outcome: OutcomeNotCallable, callbackURL: "https://example.com/cb"}
+	assert.NoError(t, r.report(ctx, task, nil))
+	notifying.Wait()
+
+	// without a callback url
+	assert.NoError(t, (&Result{}).report(ctx, task, nil))
+
+	// finally failed
+	err := fmt.Errorf("check upkeep error, %w", asynq.SkipRetry)
+	assert.Error(t, (&Result{callbackURL: "https://example.com/cb"}).report(ctx, task, err))
+
+	notifying.Wait()
+	assert.Equal(t, []string{"https://example.com/cb", "https://example.com/cb"}, n.urls)
+	first, err := ParseResult(n.bodies[0])
+	assert.NoError(t, err)
+	assert.Equal(t, OutcomeNotCallable, first.Outcome)
+	second, err := ParseResult(n.bodies[1])
+	assert.NoError(t, err)
+	assert.Equal(t, OutcomeFailed, second.Outcome)
+
+	// a failed delivery is logged, the task still succeeds
+	n.err = errors.New("callback down")
+	var logs bytes.Buffer
+	r = &Result{Outcome: OutcomeNotCallable, callbackURL: "https://example.com/cb"}
+	assert.NoError(t, r.report(pool.WithLogger(ctx, slog.New(slog.NewTextHandler(&logs, nil))), task, nil))
+	notifying.Wait()
+	assert.Contains(t, logs.String(), "callback not delivered")
+	assert.Contains(t, logs.String(), "callback down")
+}
+
+type blockNotifier chan struct{}
+
+func (n blockNotifier) Notify(ctx context.Context, callbackURL string, body []byte) error {
+	<-n
+	return nil
+}
+
+func TestWaitNotifications(t *testing.T) {
+	n := make(blockNotifier)
+	ctx := WithNotifier(context.Background(), n)
+	r := &Result{Outcome: OutcomeNotCallable, callbackURL: "https://example.com/cb"}
+	assert.NoError(t, r.report(ctx, asynq.NewTask("test", nil), nil))
+
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, WaitNotifications(timeout), context.DeadlineExceeded)
+
+	close(n)
+	assert.NoError(t, WaitNotifications(context.Background()))
+}
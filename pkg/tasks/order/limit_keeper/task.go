@@ -1,8 +1,12 @@
 package limit_keeper
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"math/big"
+	"net/url"
+	"time"
 
 	ethorder "github.com/WEPublicGoods/wetask/pkg/eth/order"
 	"github.com/WEPublicGoods/wetask/pkg/tasks"
@@ -12,6 +16,20 @@ import (
 )
 
 func NewNormalTask(networkName string, automationCompatibleAddr string, keeper string, order ethorder.LimitOrderExecuteInput, opts ...asynq.Option) (*asynq.Task, error) {
+	pl, err := newPayload(networkName, automationCompatibleAddr, keeper, order, opts)
+	if err != nil {
+		return nil, err
+	}
+	p, err := cjson.Marshal(pl)
+	if err != nil {
+		return nil, err
+	}
+	id := TaskID(networkName, pl.AutomationCompatibleAddress, order.Order, false)
+	return asynq.NewTask(tasks.ACT_LIMIT_ORDER, p, append([]asynq.Option{asynq.MaxRetry(pl.maxRetry()), asynq.TaskID(id), asynq.Retention(DefaultRetention)}, opts...)...), nil
+}
+
+// newPayload validates the inputs and the options of an execute task
+func newPayload(networkName string, automationCompatibleAddr string, keeper string, order ethorder.LimitOrderExecuteInput, opts []asynq.Option) (*payload, error) {
 	if networkName == "" {
 		return nil, fmt.Errorf("network name cannot be empty")
 	}
@@ -21,10 +39,6 @@ func NewNormalTask(networkName string, automationCompatibleAddr string, keeper s
 	if keeper == "" {
 		return nil, fmt.Errorf("keeper address cannot be empty")
 	}
-	// Validate LimitOrder fields
-	if order.AmountIn == nil {
-		return nil, fmt.Errorf("amountIn cannot be nil")
-	}
 	// Validate nested Order fields
 	if order.Order.Account == (common.Address{}) {
 		return nil, fmt.Errorf("order account cannot be empty")
@@ -38,19 +52,32 @@ func NewNormalTask(networkName string, automationCompatibleAddr string, keeper s
 	if order.Order.ExecuteFee == nil {
 		return nil, fmt.Errorf("execute fee cannot be nil")
 	}
+	// hashed by the results
+	if _, err := order.Order.Hash(); err != nil {
+		return nil, err
+	}
+	// the amounts and the routes, which would revert on chain
+	if err := order.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid limit order, %w", err)
+	}
 
 	if !common.IsHexAddress(automationCompatibleAddr) {
 		return nil, fmt.Errorf("the address of AutomationCompatible is invalid: %s", automationCompatibleAddr)
 	}
-	if !common.IsHexAddress(keeper) {
+	if !common.IsHexAddress(keeper) || common.HexToAddress(keeper) == (common.Address{}) {
 		return nil, fmt.Errorf("the address of keeper is invalid: %s", keeper)
 	}
+	// a zero fee receiver is the keeper, the contract is the only one rejected
+	if order.FeeReceiver != (common.Address{}) && order.FeeReceiver == common.HexToAddress(automationCompatibleAddr) {
+		return nil, fmt.Errorf("the fee receiver cannot be the AutomationCompatible contract: %s", automationCompatibleAddr)
+	}
 	pl := &payload{
 		NetworkName:                 networkName,
 		AutomationCompatibleAddress: common.HexToAddress(automationCompatibleAddr),
 		Keeper:                      common.HexToAddress(keeper),
 		LimitOrder:                  order,
 	}
+	allowUnknownType := false
 	for _, opt := range opts {
 		switch opt := opt.(type) {
 		case basefeeWiggleMultiplierOption:
@@ -65,13 +92,49 @@ func NewNormalTask(networkName string, automationCompatibleAddr string, keeper s
 				return nil, fmt.Errorf("the gaslimit multiplier require positive")
 			}
 			pl.GasLimitMultiplier = v
+		case callbackOption:
+			v, err := parseCallbackURL(opt.Value().(string))
+			if err != nil {
+				return nil, err
+			}
+			pl.CallbackURL = v
+		case traceOption:
+			pl.Trace = opt.Value().(map[string]string)
+		case allowUnknownOrderTypeOption:
+			allowUnknownType = opt.Value().(bool)
+		case priceTriggerOption:
+			v := opt.Value().(ethorder.Trigger)
+			if err := v.Validate(); err != nil {
+				return nil, err
+			}
+			pl.Trigger = &v
+		case expiryOption:
+			v := opt.Value().(time.Time)
+			if v.IsZero() {
+				return nil, fmt.Errorf("the expiry cannot be zero")
+			}
+			pl.ExpiresAt = v.Unix()
 		}
 	}
-	p, err := cjson.Marshal(pl)
-	if err != nil {
-		return nil, err
+	if err := order.ValidateType(); err != nil && !(allowUnknownType && errors.Is(err, ethorder.ErrUnknownOrderType)) {
+		return nil, fmt.Errorf("invalid limit order, %w", err)
+	}
+	if spec, ok := ethorder.LookupOrderType(order.Order.OrderType); ok && spec.RequiresTrigger && pl.Trigger == nil {
+		return nil, fmt.Errorf("%s orders require a PriceTrigger", spec.Name)
+	}
+	return pl, nil
+}
+
+// DefaultDeferrals is the default MaxRetry of the execute tasks without trigger
+const DefaultDeferrals = 60
+
+// maxRetry is the default MaxRetry of the execute tasks of p, only their deferrals are retried
+func (p *payload) maxRetry() int {
+	if p.Trigger != nil {
+		// every poll of the trigger is a retry
+		return math.MaxInt32
 	}
-	return asynq.NewTask(tasks.ACT_LIMIT_ORDER, p, append([]asynq.Option{asynq.MaxRetry(0)}, opts...)...), nil
+	return DefaultDeferrals
 }
 
 func NewCancelTask(networkName string, automationCompatibleAddr string, keeper string, order ethorder.Order, opts ...asynq.Option) (*asynq.Task, error) {
@@ -97,14 +160,97 @@ func NewCancelTask(networkName string, automationCompatibleAddr string, keeper s
 	if order.ExecuteFee == nil {
 		order.ExecuteFee = big.NewInt(0)
 	}
-	p, err := cjson.Marshal(cancelPayload{
+	if _, err := order.Hash(); err != nil {
+		return nil, err
+	}
+	// the fee receiver of a cancel
+	if !common.IsHexAddress(keeper) || common.HexToAddress(keeper) == (common.Address{}) {
+		return nil, fmt.Errorf("the address of keeper is invalid: %s", keeper)
+	}
+	pl := &cancelPayload{
 		NetworkName:                 networkName,
 		AutomationCompatibleAddress: common.HexToAddress(automationCompatibleAddr),
 		Keeper:                      common.HexToAddress(keeper),
 		Order:                       order,
-	})
+	}
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case callbackOption:
+			v, err := parseCallbackURL(opt.Value().(string))
+			if err != nil {
+				return nil, err
+			}
+			pl.CallbackURL = v
+		case traceOption:
+			pl.Trace = opt.Value().(map[string]string)
+		case expiryOption:
+			v := opt.Value().(time.Time)
+			if v.IsZero() {
+				return nil, fmt.Errorf("the expiry cannot be zero")
+			}
+			pl.ExpiresAt = v.Unix()
+		}
+	}
+	p, err := cjson.Marshal(pl)
 	if err != nil {
 		return nil, err
 	}
-	return asynq.NewTask(tasks.ACT_CANCEL_LIMIT_ORDER, p, append([]asynq.Option{asynq.MaxRetry(5)}, opts...)...), nil
+	id := TaskID(networkName, pl.AutomationCompatibleAddress, order, true)
+	defaults := []asynq.Option{asynq.MaxRetry(5), asynq.TaskID(id), asynq.Retention(DefaultRetention)}
+	if pl.ExpiresAt != 0 {
+		defaults = append(defaults, asynq.ProcessAt(time.Unix(pl.ExpiresAt, 0)))
+	}
+	return asynq.NewTask(tasks.ACT_CANCEL_LIMIT_ORDER, p, append(defaults, opts...)...), nil
+}
+
+// DefaultRetention keeps the completed tasks, their Result included
+const DefaultRetention = 24 * time.Hour
+
+// TaskID is the deterministic id given to the tasks of order, so the duplicates are rejected
+func TaskID(networkName string, automationCompatibleAddr common.Address, order ethorder.Order, cancel bool) string {
+	typename := tasks.ACT_LIMIT_ORDER
+	if cancel {
+		typename = tasks.ACT_CANCEL_LIMIT_ORDER
+	}
+	return fmt.Sprintf("%s:%s:%s:%s", typename, networkName, automationCompatibleAddr.Hex(), order.Key())
+}
+
+// NewTWAPTask executes order.AmountIn in equal slices, one every interval
+func NewTWAPTask(networkName string, automationCompatibleAddr string, keeper string, order ethorder.LimitOrderExecuteInput, slices int, interval time.Duration, opts ...asynq.Option) (*asynq.Task, error) {
+	if slices < 1 {
+		return nil, fmt.Errorf("the slices of a TWAP order require positive")
+	}
+	if interval < 0 {
+		return nil, fmt.Errorf("the interval of a TWAP order cannot be negative")
+	}
+	pl, err := newPayload(networkName, automationCompatibleAddr, keeper, order, opts)
+	if err != nil {
+		return nil, err
+	}
+	if order.AmountIn.Cmp(big.NewInt(int64(slices))) < 0 {
+		return nil, fmt.Errorf("the amountIn %s cannot be split in %d slices", order.AmountIn, slices)
+	}
+	p := &twapPayload{
+		payload:          *pl,
+		Slices:           slices,
+		Interval:         interval,
+		ExecutedAmountIn: big.NewInt(0),
+	}
+	return p.newTask(opts...)
+}
+
+// TWAPTaskID is the id of the task executing the slice of order
+func TWAPTaskID(networkName string, automationCompatibleAddr common.Address, order ethorder.Order, slice int) string {
+	return fmt.Sprintf("%s:%s:%s:%s:%d", tasks.ACT_TWAP_ORDER, networkName, automationCompatibleAddr.Hex(), order.Key(), slice)
+}
+
+func parseCallbackURL(v string) (string, error) {
+	u, err := url.Parse(v)
+	if err != nil {
+		return "", fmt.Errorf("the callback url is invalid: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("the callback url require http or https: %s", v)
+	}
+	return u.String(), nil
 }
@@ -0,0 +1,110 @@
+package limit_keeper
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	ethorder "github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// the order types of the tests, every type is accepted while none is registered
+const (
+	testLimit    = 0
+	testStopLoss = 1
+)
+
+func init() {
+	for _, spec := range []ethorder.OrderTypeSpec{
+		{ID: testLimit, Name: "test_limit", RequiresRoutes: true, CancelOnlyWhenExpired: true},
+		{ID: testStopLoss, Name: "test_stop_loss", RequiresRoutes: true, CancelOnlyWhenExpired: true, RequiresTrigger: true},
+	} {
+		if err := ethorder.RegisterOrderType(spec); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func TestTaskID(t *testing.T) {
+	contract := common.HexToAddress("0xc0ffee")
+	order := ethorder.Order{
+		Account:    common.HexToAddress("0x1111111111111111111111111111111111111111"),
+		Index:      big.NewInt(12),
+		OrderType:  big.NewInt(0),
+		ExecuteFee: big.NewInt(100),
+	}
+	id := TaskID("sepolia", contract, order, false)
+	assert.Equal(t, "act_limit_order:sepolia:0x0000000000000000000000000000000000C0FFEE:0x1111111111111111111111111111111111111111:12", id)
+
+	// the fee does not identify the order
+	same := order
+	same.ExecuteFee = big.NewInt(200)
+	assert.Equal(t, id, TaskID("sepolia", contract, same, false))
+
+	assert.NotEqual(t, id, TaskID("sepolia", contract, order, true))
+	assert.NotEqual(t, id, TaskID("mainnet", contract, order, false))
+	other := order
+	other.Index = big.NewInt(13)
+	assert.NotEqual(t, id, TaskID("sepolia", contract, other, false))
+}
+
+func TestMaxRetry(t *testing.T) {
+	// the deferrals of a profit or a gas policy are retried
+	p := &payload{}
+	assert.Equal(t, DefaultDeferrals, p.maxRetry())
+	p.Trigger = &ethorder.Trigger{}
+	assert.Equal(t, math.MaxInt32, p.maxRetry())
+}
+
+func TestNewNormalTask_Validate(t *testing.T) {
+	tokenIn, tokenOut := common.HexToAddress("0x2222222222222222222222222222222222222222"), common.HexToAddress("0x3333333333333333333333333333333333333333")
+	input := ethorder.LimitOrderExecuteInput{
+		Order:             ethorder.Order{Account: common.HexToAddress("0x1111111111111111111111111111111111111111"), Index: big.NewInt(1), OrderType: big.NewInt(0), ExecuteFee: big.NewInt(0)},
+		TokenIn:           tokenIn,
+		TokenOut:          tokenOut,
+		RemainingAmountIn: big.NewInt(1000),
+		Routes:            []ethorder.SwapRoute{{TokenIn: tokenIn, TokenOut: tokenIn, AmountIn: big.NewInt(1000), AmountOutMin: big.NewInt(0)}},
+		AmountIn:          big.NewInt(1000),
+		AmountOutMin:      big.NewInt(0),
+		AmountOutExpected: big.NewInt(0),
+	}
+	_, err := NewNormalTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", input)
+	assert.ErrorIs(t, err, ethorder.ErrBrokenRoute)
+
+	input.Routes[0].TokenOut = tokenOut
+	_, err = NewNormalTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", input)
+	assert.NoError(t, err)
+
+	// the fee receiver would be zero
+	_, err = NewNormalTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000000000", input)
+	assert.Error(t, err)
+	_, err = NewCancelTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000000000", input.Order)
+	assert.Error(t, err)
+
+	// the order is not hashed with a negative index
+	input.Order.Index = big.NewInt(-1)
+	_, err = NewNormalTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", input)
+	assert.ErrorIs(t, err, ethorder.ErrInvalidAmount)
+	_, err = NewCancelTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", input.Order)
+	assert.ErrorIs(t, err, ethorder.ErrInvalidAmount)
+}
+
+func TestNewNormalTask_OrderType(t *testing.T) {
+	tokenIn, tokenOut := common.HexToAddress("0x2222222222222222222222222222222222222222"), common.HexToAddress("0x3333333333333333333333333333333333333333")
+	input := ethorder.LimitOrderExecuteInput{
+		Order:             ethorder.Order{Account: common.HexToAddress("0x1111111111111111111111111111111111111111"), Index: big.NewInt(1), OrderType: big.NewInt(99), ExecuteFee: big.NewInt(0)},
+		TokenIn:           tokenIn,
+		TokenOut:          tokenOut,
+		RemainingAmountIn: big.NewInt(1000),
+		Routes:            []ethorder.SwapRoute{{TokenIn: tokenIn, TokenOut: tokenOut, AmountIn: big.NewInt(1000), AmountOutMin: big.NewInt(0)}},
+		AmountIn:          big.NewInt(1000),
+		AmountOutMin:      big.NewInt(0),
+		AmountOutExpected: big.NewInt(0),
+	}
+	_, err := NewNormalTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", input)
+	assert.ErrorIs(t, err, ethorder.ErrUnknownOrderType)
+	_, err = NewNormalTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", input, AllowUnknownOrderType())
+	assert.NoError(t, err)
+}
@@ -0,0 +1,71 @@
+package limit_keeper
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/pool"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hibiken/asynq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/WEPublicGoods/wetask/pkg/tasks/order/limit_keeper")
+
+// startTask starts the span of a handler, continuing the trace of the enqueuer
+func (r *Result) startTask(ctx context.Context, name string, carrier map[string]string) context.Context {
+	ctx, r.span = tracer.Start(tasks.ExtractTrace(ctx, carrier), name,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(orderAttributes(r.NetworkName, r.AutomationCompatibleAddress, r.Keeper, r.Order)...))
+	logger := pool.Logger(ctx).With(
+		slog.String("network", r.NetworkName),
+		slog.String("contract", r.AutomationCompatibleAddress.Hex()),
+		slog.String("keeper", r.Keeper.Hex()),
+		slog.String("order", r.OrderKey),
+		slog.String("orderHash", r.OrderHash.Hex()),
+		slog.String("orderType", r.Order.TypeName()),
+		slog.Bool("cancel", r.Cancel),
+	)
+	if id, ok := asynq.GetTaskID(ctx); ok {
+		r.span.SetAttributes(attribute.String("wetask.task_id", id))
+		logger = logger.With(slog.String("taskId", id))
+	}
+	r.logger = logger
+	return pool.WithLogger(ctx, logger)
+}
+
+func orderAttributes(networkName string, automationCompatibleAddress, keeper common.Address, o order.Order) []attribute.KeyValue {
+	hash, _ := o.Hash()
+	return []attribute.KeyValue{
+		attribute.String("wetask.network", networkName),
+		attribute.String("wetask.contract", automationCompatibleAddress.Hex()),
+		attribute.String("wetask.keeper", keeper.Hex()),
+		attribute.String("wetask.order", o.Key()),
+		attribute.String("wetask.order.hash", hash.Hex()),
+	}
+}
+
+// endTask ends the span of startTask with the outcome of the task
+func (r *Result) endTask(err error) {
+	if r.span == nil {
+		return
+	}
+	r.span.SetAttributes(attribute.String("wetask.outcome", string(r.Outcome)))
+	if n := len(r.TxHashes); n > 0 {
+		r.span.SetAttributes(attribute.String("wetask.tx_hash", r.TxHashes[n-1].Hex()))
+	}
+	endSpan(r.span, err)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,117 @@
+package limit_keeper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	ethorder "github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/pool"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans records the spans of the package until the end of the test,
+// the global tracer provider delegates to the first provider set only
+func recordSpans(t *testing.T) (*tracetest.SpanRecorder, trace.TracerProvider) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := tracer
+	tracer = tp.Tracer("github.com/WEPublicGoods/wetask/pkg/tasks/order/limit_keeper")
+	t.Cleanup(func() { tracer = prev })
+	return recorder, tp
+}
+
+func TestTrace(t *testing.T) {
+	recorder, tp := recordSpans(t)
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "enqueue")
+	task, err := NewNormalTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", ethorder.LimitOrderExecuteInput{
+		Order: ethorder.Order{
+			Account:    common.HexToAddress("0x1111111111111111111111111111111111111111"),
+			Index:      big.NewInt(7),
+			OrderType:  big.NewInt(0),
+			ExecuteFee: big.NewInt(100),
+		},
+		TokenIn:           common.HexToAddress("0x2222222222222222222222222222222222222222"),
+		TokenOut:          common.HexToAddress("0x3333333333333333333333333333333333333333"),
+		RemainingAmountIn: big.NewInt(1000),
+		Routes: []ethorder.SwapRoute{{
+			TokenIn:      common.HexToAddress("0x2222222222222222222222222222222222222222"),
+			TokenOut:     common.HexToAddress("0x3333333333333333333333333333333333333333"),
+			AmountIn:     big.NewInt(1000),
+			AmountOutMin: big.NewInt(0),
+		}},
+		AmountIn:          big.NewInt(1000),
+		AmountOutMin:      big.NewInt(0),
+		AmountOutExpected: big.NewInt(0),
+	}, Trace(ctx))
+	assert.NoError(t, err)
+	parent.End()
+	p, err := parsePayloadFrom(task)
+	assert.NoError(t, err)
+	assert.Contains(t, p.Trace, "traceparent")
+
+	// no pool in the context, the handler fails right after the span started
+	assert.Error(t, Handle(context.Background(), task))
+	var found bool
+	for _, span := range recorder.Ended() {
+		if span.Name() != "limit_keeper.Handle" {
+			continue
+		}
+		found = true
+		assert.Equal(t, parent.SpanContext().TraceID(), span.SpanContext().TraceID())
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+		assert.Contains(t, span.Attributes(), attribute.String("wetask.order", "0x1111111111111111111111111111111111111111:7"))
+		assert.Contains(t, span.Attributes(), attribute.String("wetask.outcome", string(OutcomeFailed)))
+	}
+	assert.True(t, found)
+
+	// without a span nothing is carried
+	task, err = NewCancelTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", p.LimitOrder.Order, Trace(context.Background()))
+	assert.NoError(t, err)
+	cp, err := parseCancelPayloadFrom(task)
+	assert.NoError(t, err)
+	assert.Nil(t, cp.Trace)
+}
+
+func TestLogOutcome(t *testing.T) {
+	task, err := NewCancelTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", ethorder.Order{
+		Account:   common.HexToAddress("0x1111111111111111111111111111111111111111"),
+		Index:     big.NewInt(7),
+		OrderType: big.NewInt(0),
+	})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	ctx := pool.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(&buf, nil)))
+	assert.Error(t, HandleCancel(ctx, task))
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "task done", record["msg"])
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, string(OutcomeFailed), record["outcome"])
+	assert.Equal(t, "sepolia", record["network"])
+	assert.Equal(t, "0x1111111111111111111111111111111111111111:7", record["order"])
+	hash, err := ethorder.Order{
+		Account:    common.HexToAddress("0x1111111111111111111111111111111111111111"),
+		Index:      big.NewInt(7),
+		OrderType:  big.NewInt(0),
+		ExecuteFee: big.NewInt(0),
+	}.Hash()
+	assert.NoError(t, err)
+	assert.Equal(t, hash.Hex(), record["orderHash"])
+	assert.Equal(t, true, record["cancel"])
+}
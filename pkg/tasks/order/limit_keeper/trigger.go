@@ -0,0 +1,44 @@
+package limit_keeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/pool"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var ErrTriggerNotCrossed = errors.New("trigger not crossed")
+
+// DefaultTriggerPollInterval is the poll interval of the triggers without one
+const DefaultTriggerPollInterval = 30 * time.Second
+
+// checkTrigger defers the execution until the price of trigger crosses its threshold
+func checkTrigger(ctx context.Context, client eclient.Ethclient, trigger *order.Trigger) (err error) {
+	ctx, span := tracer.Start(ctx, "checkTrigger")
+	defer func() { endSpan(span, err) }()
+	interval := trigger.PollInterval
+	if interval == 0 {
+		interval = DefaultTriggerPollInterval
+	}
+	backend, err := client.GetClient(ctx)
+	if err != nil {
+		return tasks.Defer(err, interval)
+	}
+	crossed, price, err := trigger.Check(ctx, backend)
+	if err != nil {
+		return tasks.Defer(fmt.Errorf("check trigger: %w", err), interval)
+	}
+	span.SetAttributes(attribute.String("wetask.price", price.String()), attribute.Bool("wetask.crossed", crossed))
+	pool.Logger(ctx).Debug("trigger checked", slog.String("price", price.String()), slog.String("threshold", trigger.Threshold.String()), slog.Bool("crossed", crossed))
+	if crossed {
+		return nil
+	}
+	return tasks.Defer(fmt.Errorf("%w: price %s, threshold %s", ErrTriggerNotCrossed, price, trigger.Threshold), interval)
+}
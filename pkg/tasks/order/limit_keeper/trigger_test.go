@@ -0,0 +1,109 @@
+package limit_keeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/pool"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+)
+
+var errNoUpkeep = errors.New("no upkeep")
+
+// aggregatorBackend answers latestRoundData with answer, and fails the other calls
+type aggregatorBackend struct {
+	bind.ContractBackend
+	aggregator abi.ABI
+	answer     int64
+}
+
+func (b *aggregatorBackend) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return []byte{0x60}, nil
+}
+
+func (b *aggregatorBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	method, err := b.aggregator.MethodById(call.Data[:4])
+	if err != nil {
+		return nil, errNoUpkeep
+	}
+	now := big.NewInt(time.Now().Unix())
+	return method.Outputs.Pack(big.NewInt(1), big.NewInt(b.answer), now, now, big.NewInt(1))
+}
+
+type triggerClient struct {
+	resumeClient
+	backend *aggregatorBackend
+}
+
+func (c *triggerClient) GetClient(ctx context.Context) (bind.ContractBackend, error) {
+	return c.backend, nil
+}
+
+func TestTrigger(t *testing.T) {
+	aggregator, err := abi.JSON(strings.NewReader(`[{"inputs":[],"name":"latestRoundData","outputs":[{"name":"roundId","type":"uint80"},{"name":"answer","type":"int256"},{"name":"startedAt","type":"uint256"},{"name":"updatedAt","type":"uint256"},{"name":"answeredInRound","type":"uint80"}],"stateMutability":"view","type":"function"}]`))
+	assert.NoError(t, err)
+	client := &triggerClient{backend: &aggregatorBackend{aggregator: aggregator, answer: 2100}}
+	ctx := pool.WithPool(context.Background(), []eclient.Ethclient{client}, keystore.NewKeyStore(t.TempDir(), keystore.LightScryptN, keystore.LightScryptP))
+
+	trigger := order.Trigger{Source: order.TriggerSourceChainlink, Feed: common.HexToAddress("0xfeed"), Threshold: big.NewInt(2000), PollInterval: time.Minute}
+	tokenIn, tokenOut := common.HexToAddress("0x2222222222222222222222222222222222222222"), common.HexToAddress("0x3333333333333333333333333333333333333333")
+	input := order.LimitOrderExecuteInput{
+		Order:             order.Order{Account: common.HexToAddress("0x1111111111111111111111111111111111111111"), Index: big.NewInt(1), OrderType: big.NewInt(testStopLoss), ExecuteFee: big.NewInt(0)},
+		TokenIn:           tokenIn,
+		TokenOut:          tokenOut,
+		RemainingAmountIn: big.NewInt(1000),
+		Routes:            []order.SwapRoute{{TokenIn: tokenIn, TokenOut: tokenOut, AmountIn: big.NewInt(1000), AmountOutMin: big.NewInt(0)}},
+		AmountIn:          big.NewInt(1000),
+		AmountOutMin:      big.NewInt(0),
+		AmountOutExpected: big.NewInt(0),
+	}
+	_, err = NewNormalTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", input)
+	assert.Error(t, err, "a stop-loss requires a trigger")
+	task, err := NewNormalTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", input, PriceTrigger(trigger))
+	assert.NoError(t, err)
+
+	// above the stop-loss, polled again after the interval
+	r := new(Result)
+	err = handle(ctx, task, r)
+	assert.ErrorIs(t, err, ErrTriggerNotCrossed)
+	var de *tasks.DeferError
+	if assert.ErrorAs(t, err, &de) {
+		assert.Equal(t, time.Minute, de.Delay)
+	}
+	assert.ErrorIs(t, r.report(ctx, task, err), ErrTriggerNotCrossed)
+	assert.Equal(t, OutcomeWaiting, r.Outcome)
+
+	assert.False(t, errors.Is(err, asynq.SkipRetry))
+
+	// crossed, the order goes on to checkUpkeep, its failures are not retried like the polls
+	client.backend.answer = 1999
+	err = handle(ctx, task, new(Result))
+	assert.NotErrorIs(t, err, ErrTriggerNotCrossed)
+	assert.ErrorContains(t, err, errNoUpkeep.Error())
+	assert.ErrorIs(t, err, asynq.SkipRetry)
+	assert.True(t, isFinal(ctx, err))
+}
+
+func TestOnlyDeferred(t *testing.T) {
+	assert.NoError(t, onlyDeferred(nil))
+	deferred := tasks.Defer(ErrTriggerNotCrossed, time.Minute)
+	assert.Equal(t, deferred, onlyDeferred(deferred))
+	reverted := fmt.Errorf("wait receipt: %w", eclient.ErrTransactionReverted)
+	err := onlyDeferred(reverted)
+	assert.ErrorIs(t, err, asynq.SkipRetry)
+	assert.ErrorIs(t, err, eclient.ErrTransactionReverted)
+}
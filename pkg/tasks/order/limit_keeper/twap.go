@@ -0,0 +1,183 @@
+package limit_keeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/hibiken/asynq"
+	"github.com/tinkler/moonmist/pkg/jsonz/cjson"
+)
+
+type twapPayload struct {
+	payload
+	// LimitOrder.AmountIn is executed in Slices slices, one every Interval
+	Slices   int
+	Interval time.Duration
+	// the index of the slice executed by the task
+	Slice int
+	// executed by the previous slices
+	ExecutedAmountIn *big.Int
+}
+
+// SliceProgress is the progress of a TWAP order once a slice is handled
+type SliceProgress struct {
+	Slice  int
+	Slices int
+	// the AmountIn of the slice
+	AmountIn *big.Int
+	// executed by the slices so far
+	ExecutedAmountIn *big.Int
+	// left on chain
+	RemainingAmountIn *big.Int
+	// the id of the task of the next slice, empty once the order is done
+	NextTaskID string
+}
+
+type enqueuerKey struct{}
+
+// WithEnqueuer enqueues the next slices of the TWAP orders with enqueuer, usually an *asynq.Client
+func WithEnqueuer(ctx context.Context, enqueuer tasks.Enqueuer) context.Context {
+	return context.WithValue(ctx, enqueuerKey{}, enqueuer)
+}
+
+func parseTWAPPayloadFrom(t *asynq.Task) (*twapPayload, error) {
+	var p twapPayload
+	if err := cjson.Unmarshal(t.Payload(), &p); err != nil {
+		return nil, fmt.Errorf("cjson.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+	if p.Slices < 1 || p.ExecutedAmountIn == nil || p.LimitOrder.AmountIn == nil || p.LimitOrder.RemainingAmountIn == nil {
+		return nil, fmt.Errorf("incomplete twap payload: %w", asynq.SkipRetry)
+	}
+	return &p, nil
+}
+
+func (p *twapPayload) newTask(opts ...asynq.Option) (*asynq.Task, error) {
+	data, err := cjson.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	id := TWAPTaskID(p.NetworkName, p.AutomationCompatibleAddress, p.LimitOrder.Order, p.Slice)
+	return asynq.NewTask(tasks.ACT_TWAP_ORDER, data, append([]asynq.Option{asynq.MaxRetry(p.maxRetry()), asynq.TaskID(id), asynq.Retention(DefaultRetention)}, opts...)...), nil
+}
+
+// slice is the execute payload of the current slice, the last one takes what is left
+func (p *twapPayload) slice() (*payload, error) {
+	left := new(big.Int).Sub(p.LimitOrder.AmountIn, p.ExecutedAmountIn)
+	if left.Cmp(p.LimitOrder.RemainingAmountIn) > 0 {
+		left.Set(p.LimitOrder.RemainingAmountIn)
+	}
+	amountIn := left
+	if p.Slice < p.Slices-1 {
+		share := new(big.Int).Quo(p.LimitOrder.AmountIn, big.NewInt(int64(p.Slices)))
+		if share.Cmp(left) < 0 {
+			amountIn = share
+		}
+	}
+	in, err := p.LimitOrder.Slice(amountIn)
+	if err != nil {
+		return nil, err
+	}
+	slice := p.payload
+	slice.LimitOrder = *in
+	return &slice, nil
+}
+
+// next is the payload of the slice following the fill of the execution
+func (p *twapPayload) next(fill *order.Fill) *twapPayload {
+	remaining := new(big.Int).Sub(p.LimitOrder.RemainingAmountIn, fill.AmountIn)
+	if fill.RemainingAmountIn != nil {
+		remaining = fill.RemainingAmountIn
+	}
+	if remaining.Sign() < 0 {
+		remaining = big.NewInt(0)
+	}
+	next := *p
+	next.Slice++
+	next.ExecutedAmountIn = new(big.Int).Add(p.ExecutedAmountIn, fill.AmountIn)
+	next.LimitOrder.RemainingAmountIn = remaining
+	return &next
+}
+
+// done tells whether the order has nothing left to execute
+func (p *twapPayload) done() bool {
+	return p.Slice >= p.Slices ||
+		p.LimitOrder.RemainingAmountIn.Sign() == 0 ||
+		p.ExecutedAmountIn.Cmp(p.LimitOrder.AmountIn) >= 0
+}
+
+// ErrFillUnknown fails a TWAP order whose slice was executed without a decoded fill
+var ErrFillUnknown = errors.New("fill of the slice unknown")
+
+// HandleTWAP executes a slice of a TWAP order like Handle, then enqueues the next one
+func HandleTWAP(ctx context.Context, t *asynq.Task) error {
+	r := new(Result)
+	return r.report(ctx, t, handleTWAP(ctx, t, r, execute, "limit_keeper.HandleTWAP"))
+}
+
+// HandleTWAP executes a slice of a TWAP order like OptimizeExecutor.Handle
+func (oe *OptimizeExecutor) HandleTWAP(ctx context.Context, t *asynq.Task) error {
+	r := new(Result)
+	return r.report(ctx, t, handleTWAP(ctx, t, r, oe.execute, "limit_keeper.OptimizeExecutor.HandleTWAP"))
+}
+
+func handleTWAP(ctx context.Context, t *asynq.Task, r *Result, execute executeFunc, name string) error {
+	p, err := parseTWAPPayloadFrom(t)
+	if err != nil {
+		return err
+	}
+	r.setPayload(&p.payload)
+	enqueuer, ok := ctx.Value(enqueuerKey{}).(tasks.Enqueuer)
+	if !ok {
+		return fmt.Errorf("no enqueuer for the next slices, see WithEnqueuer, %w", asynq.SkipRetry)
+	}
+	slice, err := p.slice()
+	if err != nil {
+		return fmt.Errorf("slice %d of %d: %s, %w", p.Slice, p.Slices, err.Error(), asynq.SkipRetry)
+	}
+	r.Slice = &SliceProgress{
+		Slice:             p.Slice,
+		Slices:            p.Slices,
+		AmountIn:          slice.LimitOrder.AmountIn,
+		ExecutedAmountIn:  p.ExecutedAmountIn,
+		RemainingAmountIn: p.LimitOrder.RemainingAmountIn,
+	}
+	if err := execute(ctx, slice, r, name); err != nil {
+		return onlyDeferred(err)
+	}
+	if r.Outcome == OutcomeNotCallable || r.Outcome == OutcomeExpired {
+		// filled, cancelled or expired
+		return nil
+	}
+	suppressCancel(ctx, slice, r)
+	if r.Fill == nil || r.Fill.AmountIn == nil {
+		// the amount executed is not guessed, the next slices could spend more than the order
+		return fmt.Errorf("slice %d of %d: %w, %w", p.Slice, p.Slices, ErrFillUnknown, asynq.SkipRetry)
+	}
+	next := p.next(r.Fill)
+	r.Slice.ExecutedAmountIn, r.Slice.RemainingAmountIn = next.ExecutedAmountIn, next.LimitOrder.RemainingAmountIn
+	if next.done() {
+		return nil
+	}
+	opts := []asynq.Option{asynq.ProcessIn(p.Interval)}
+	if queue, ok := asynq.GetQueueName(ctx); ok {
+		opts = append(opts, asynq.Queue(queue))
+	}
+	if maxRetry, ok := asynq.GetMaxRetry(ctx); ok {
+		opts = append(opts, asynq.MaxRetry(maxRetry))
+	}
+	task, err := next.newTask(opts...)
+	if err != nil {
+		return fmt.Errorf("slice %d: %s, %w", next.Slice, err.Error(), asynq.SkipRetry)
+	}
+	// a duplicate is enqueued by a previous delivery of the slice, a retry would execute it again
+	if _, err := tasks.EnqueueUnique(ctx, enqueuer, task, 0); err != nil && !errors.Is(err, tasks.ErrDuplicateTask) {
+		return fmt.Errorf("enqueue slice %d: %s, %w", next.Slice, err.Error(), asynq.SkipRetry)
+	}
+	r.Slice.NextTaskID = TWAPTaskID(next.NetworkName, next.AutomationCompatibleAddress, next.LimitOrder.Order, next.Slice)
+	return nil
+}
@@ -0,0 +1,147 @@
+package limit_keeper
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/order"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordEnqueuer struct {
+	tasks []*asynq.Task
+	err   error
+}
+
+func (e *recordEnqueuer) EnqueueContext(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	e.tasks = append(e.tasks, task)
+	return &asynq.TaskInfo{ID: task.Type()}, nil
+}
+
+func twapInput() order.LimitOrderExecuteInput {
+	tokenIn, tokenOut := common.HexToAddress("0x2222222222222222222222222222222222222222"), common.HexToAddress("0x3333333333333333333333333333333333333333")
+	return order.LimitOrderExecuteInput{
+		Order:             order.Order{Account: common.HexToAddress("0x1111111111111111111111111111111111111111"), Index: big.NewInt(1), OrderType: big.NewInt(0), ExecuteFee: big.NewInt(0)},
+		TokenIn:           tokenIn,
+		TokenOut:          tokenOut,
+		RemainingAmountIn: big.NewInt(1000),
+		Routes:            []order.SwapRoute{{TokenIn: tokenIn, TokenOut: tokenOut, AmountIn: big.NewInt(1000), AmountOutMin: big.NewInt(1800)}},
+		AmountIn:          big.NewInt(1000),
+		AmountOutMin:      big.NewInt(1800),
+		AmountOutExpected: big.NewInt(2000),
+	}
+}
+
+func TestNewTWAPTask(t *testing.T) {
+	task, err := NewTWAPTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", twapInput(), 3, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, tasks.ACT_TWAP_ORDER, task.Type())
+	p, err := parseTWAPPayloadFrom(task)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, p.Slices)
+	assert.Equal(t, time.Hour, p.Interval)
+	assert.Equal(t, 0, p.Slice)
+	assert.Equal(t, "0", p.ExecutedAmountIn.String())
+
+	d, err := DecodeTask(task)
+	assert.NoError(t, err)
+	in, _, err := order.DecodeLimitOrderExecuteInput(d.OrderData)
+	assert.NoError(t, err)
+	assert.Equal(t, "333", in.AmountIn.String())
+	assert.Equal(t, "599", in.AmountOutMin.String())
+
+	_, err = NewTWAPTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", twapInput(), 0, time.Hour)
+	assert.Error(t, err)
+	_, err = NewTWAPTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", twapInput(), 1001, time.Hour)
+	assert.Error(t, err)
+	_, err = NewTWAPTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", twapInput(), 3, -time.Hour)
+	assert.Error(t, err)
+}
+
+func TestHandleTWAP(t *testing.T) {
+	task, err := NewTWAPTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", twapInput(), 3, time.Hour)
+	assert.NoError(t, err)
+
+	// fills whole slices, unless partial is set
+	var (
+		executed []string
+		partial  *big.Int
+	)
+	execute := func(ctx context.Context, p *payload, r *Result, name string) error {
+		r.setPayload(p)
+		executed = append(executed, p.LimitOrder.AmountIn.String()+"/"+p.LimitOrder.RemainingAmountIn.String())
+		amountIn := p.LimitOrder.AmountIn
+		if partial != nil {
+			amountIn = partial
+		}
+		r.Fill = &order.Fill{AmountIn: amountIn, RemainingAmountIn: new(big.Int).Sub(p.LimitOrder.RemainingAmountIn, amountIn)}
+		return nil
+	}
+
+	enqueuer := new(recordEnqueuer)
+	ctx := WithEnqueuer(context.Background(), enqueuer)
+	for {
+		r := new(Result)
+		assert.NoError(t, handleTWAP(ctx, task, r, execute, "test"))
+		if r.Slice.NextTaskID == "" {
+			break
+		}
+		assert.Len(t, enqueuer.tasks, r.Slice.Slice+1)
+		task = enqueuer.tasks[len(enqueuer.tasks)-1]
+		assert.Equal(t, TWAPTaskID("sepolia", common.HexToAddress("0xc0ff"), twapInput().Order, r.Slice.Slice+1), r.Slice.NextTaskID)
+	}
+	assert.Equal(t, []string{"333/1000", "333/667", "334/334"}, executed)
+	assert.Len(t, enqueuer.tasks, 2)
+
+	// the order is filled on chain by a partial fill reporting nothing left
+	executed, enqueuer.tasks = nil, nil
+	task, _ = NewTWAPTask("sepolia", "0x000000000000000000000000000000000000c0ff", "0x0000000000000000000000000000000000001234", twapInput(), 3, time.Hour)
+	partial = big.NewInt(1000)
+	r := new(Result)
+	assert.NoError(t, handleTWAP(ctx, task, r, execute, "test"))
+	assert.Empty(t, enqueuer.tasks)
+	assert.Equal(t, "0", r.Slice.RemainingAmountIn.String())
+	assert.Equal(t, "1000", r.Slice.ExecutedAmountIn.String())
+	assert.Empty(t, r.Slice.NextTaskID)
+	partial = nil
+
+	// cancelled or filled by someone else
+	r = new(Result)
+	notCallable := func(ctx context.Context, p *payload, r *Result, name string) error {
+		r.Outcome = OutcomeNotCallable
+		return nil
+	}
+	assert.NoError(t, handleTWAP(ctx, task, r, notCallable, "test"))
+	assert.Empty(t, enqueuer.tasks)
+
+	// a failed slice is final, without enqueuing the next one
+	failed := errors.New("failed")
+	err = handleTWAP(ctx, task, new(Result), func(ctx context.Context, p *payload, r *Result, name string) error { return failed }, "test")
+	assert.ErrorIs(t, err, failed)
+	assert.ErrorIs(t, err, asynq.SkipRetry)
+	assert.Empty(t, enqueuer.tasks)
+
+	// the amount executed is not known
+	err = handleTWAP(ctx, task, new(Result), func(ctx context.Context, p *payload, r *Result, name string) error { return nil }, "test")
+	assert.ErrorIs(t, err, ErrFillUnknown)
+	assert.ErrorIs(t, err, asynq.SkipRetry)
+	assert.Empty(t, enqueuer.tasks)
+
+	// the next slice is enqueued already
+	enqueuer.err = asynq.ErrTaskIDConflict
+	assert.NoError(t, handleTWAP(ctx, task, new(Result), execute, "test"))
+	// the executed slice is not retried
+	enqueuer.err = errors.New("redis down")
+	assert.ErrorIs(t, handleTWAP(ctx, task, new(Result), execute, "test"), asynq.SkipRetry)
+
+	assert.ErrorIs(t, handleTWAP(context.Background(), task, new(Result), execute, "test"), asynq.SkipRetry)
+}
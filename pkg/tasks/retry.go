@@ -0,0 +1,41 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+// DeferError asks for the task to be retried after Delay, it counts as a retry
+type DeferError struct {
+	Err   error
+	Delay time.Duration
+}
+
+func (e *DeferError) Error() string {
+	return fmt.Sprintf("deferred for %s: %v", e.Delay, e.Err)
+}
+
+func (e *DeferError) Unwrap() error { return e.Err }
+
+func Defer(err error, delay time.Duration) error {
+	return &DeferError{Err: err, Delay: delay}
+}
+
+// RetryDelay is an asynq.RetryDelayFunc honoring DeferError
+func RetryDelay(n int, err error, t *asynq.Task) time.Duration {
+	return RetryDelayOr(asynq.DefaultRetryDelayFunc)(n, err, t)
+}
+
+// RetryDelayOr honors DeferError, the delay of the other errors is given by fn
+func RetryDelayOr(fn asynq.RetryDelayFunc) asynq.RetryDelayFunc {
+	return func(n int, err error, t *asynq.Task) time.Duration {
+		var de *DeferError
+		if errors.As(err, &de) && de.Delay > 0 {
+			return de.Delay
+		}
+		return fn(n, err, t)
+	}
+}
@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// Logger adapts a slog.Logger to asynq.Logger
+type Logger struct {
+	logger *slog.Logger
+}
+
+func NewLogger(logger *slog.Logger) *Logger {
+	return &Logger{logger: logger.With(slog.String("component", "asynq"))}
+}
+
+func (l *Logger) log(level slog.Level, args []interface{}) {
+	ctx := context.Background()
+	if l.logger.Enabled(ctx, level) {
+		l.logger.Log(ctx, level, fmt.Sprint(args...))
+	}
+}
+
+func (l *Logger) Debug(args ...interface{}) { l.log(slog.LevelDebug, args) }
+func (l *Logger) Info(args ...interface{})  { l.log(slog.LevelInfo, args) }
+func (l *Logger) Warn(args ...interface{})  { l.log(slog.LevelWarn, args) }
+func (l *Logger) Error(args ...interface{}) { l.log(slog.LevelError, args) }
+
+func (l *Logger) Fatal(args ...interface{}) {
+	l.log(slog.LevelError, args)
+	os.Exit(1)
+}
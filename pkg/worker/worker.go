@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/WEPublicGoods/wetask/pkg/pool"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/WEPublicGoods/wetask/pkg/tasks/order/limit_keeper"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/hibiken/asynq"
+)
+
+type Mode int
+
+const (
+	// one transaction per task, fees and nonce chosen by the node
+	ModeDirect Mode = iota
+	// managed nonces and fee bumps
+	ModeOptimize
+)
+
+type options struct {
+	mode     Mode
+	contexts []func(context.Context) context.Context
+}
+
+type Option func(*options)
+
+func WithMode(mode Mode) Option {
+	return func(o *options) { o.mode = mode }
+}
+
+// WithContext installs the worker wide values in the base context of the server
+func WithContext(fn func(ctx context.Context) context.Context) Option {
+	return func(o *options) { o.contexts = append(o.contexts, fn) }
+}
+
+func newOptions(opts []Option) *options {
+	o := new(options)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Register registers the handlers on mux, the server of cfg retries their deferrals after their delay
+func Register(mux *asynq.ServeMux, cfg *asynq.Config, opts ...Option) {
+	cfg.RetryDelayFunc = retryDelay(cfg.RetryDelayFunc)
+	register(mux, newOptions(opts))
+}
+
+// retryDelay honors the deferrals before fn
+func retryDelay(fn asynq.RetryDelayFunc) asynq.RetryDelayFunc {
+	if fn == nil {
+		return tasks.RetryDelay
+	}
+	return tasks.RetryDelayOr(fn)
+}
+
+func register(mux *asynq.ServeMux, o *options) {
+	switch o.mode {
+	case ModeOptimize:
+		oe := limit_keeper.NewOptimizeExecutor()
+		mux.HandleFunc(tasks.ACT_LIMIT_ORDER, oe.Handle)
+		mux.HandleFunc(tasks.ACT_CANCEL_LIMIT_ORDER, oe.HandleCancel)
+		mux.HandleFunc(tasks.ACT_TWAP_ORDER, oe.HandleTWAP)
+	default:
+		mux.HandleFunc(tasks.ACT_LIMIT_ORDER, limit_keeper.Handle)
+		mux.HandleFunc(tasks.ACT_CANCEL_LIMIT_ORDER, limit_keeper.HandleCancel)
+		mux.HandleFunc(tasks.ACT_TWAP_ORDER, limit_keeper.HandleTWAP)
+	}
+}
+
+type Config struct {
+	asynq.Config
+	Redis   asynq.RedisConnOpt
+	Clients []eclient.Ethclient
+	Wallet  *keystore.KeyStore
+}
+
+type Server struct {
+	*asynq.Server
+	Mux *asynq.ServeMux
+	// enqueues the next slices of the TWAP orders
+	client *asynq.Client
+	// deletes the expiry cancels of the filled orders
+	inspector *asynq.Inspector
+	// also bounds the callbacks delivered at shutdown
+	shutdownTimeout time.Duration
+}
+
+// NewServer creates the server with the pool in its base context and every handler registered
+func NewServer(cfg Config, opts ...Option) *Server {
+	o := newOptions(opts)
+	client, inspector := asynq.NewClient(cfg.Redis), asynq.NewInspector(cfg.Redis)
+	// before the options, which may replace them
+	o.contexts = append([]func(context.Context) context.Context{func(ctx context.Context) context.Context {
+		ctx = tasks.WithInspector(limit_keeper.WithEnqueuer(ctx, client), inspector)
+		return limit_keeper.WithTaskDeleter(ctx, inspector)
+	}}, o.contexts...)
+	cfg.Config.BaseContext = baseContext(cfg, o)
+	cfg.Config.RetryDelayFunc = retryDelay(cfg.Config.RetryDelayFunc)
+	if cfg.Config.ShutdownTimeout <= 0 {
+		// the default of asynq
+		cfg.Config.ShutdownTimeout = 8 * time.Second
+	}
+	mux := asynq.NewServeMux()
+	register(mux, o)
+	return &Server{
+		Server:          asynq.NewServer(cfg.Redis, cfg.Config),
+		Mux:             mux,
+		client:          client,
+		inspector:       inspector,
+		shutdownTimeout: cfg.Config.ShutdownTimeout,
+	}
+}
+
+// baseContext is built once, the values keeping state across the tasks are shared
+func baseContext(cfg Config, o *options) func() context.Context {
+	ctx := context.Background()
+	if cfg.Config.BaseContext != nil {
+		ctx = cfg.Config.BaseContext()
+	}
+	ctx = pool.WithPool(ctx, cfg.Clients, cfg.Wallet)
+	for _, fn := range o.contexts {
+		ctx = fn(ctx)
+	}
+	return func() context.Context { return ctx }
+}
+
+func (s *Server) Run() error {
+	defer s.close()
+	return s.Server.Run(s.Mux)
+}
+
+func (s *Server) Start() error {
+	return s.Server.Start(s.Mux)
+}
+
+func (s *Server) Shutdown() {
+	s.Server.Shutdown()
+	s.close()
+}
+
+// close waits for the callbacks of the last tasks
+func (s *Server) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	_ = limit_keeper.WaitNotifications(ctx)
+	s.client.Close()
+	s.inspector.Close()
+}
@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WEPublicGoods/wetask/pkg/eth/eclient"
+	"github.com/WEPublicGoods/wetask/pkg/pool"
+	"github.com/WEPublicGoods/wetask/pkg/tasks"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	for _, mode := range []Mode{ModeDirect, ModeOptimize} {
+		mux := asynq.NewServeMux()
+		var cfg asynq.Config
+		Register(mux, &cfg, WithMode(mode))
+		for _, typename := range []string{tasks.ACT_LIMIT_ORDER, tasks.ACT_CANCEL_LIMIT_ORDER, tasks.ACT_TWAP_ORDER} {
+			_, pattern := mux.Handler(asynq.NewTask(typename, nil))
+			assert.Equal(t, typename, pattern)
+		}
+		assert.Equal(t, time.Minute, cfg.RetryDelayFunc(1, tasks.Defer(errors.New("over cap"), time.Minute), nil))
+	}
+
+	// the deferrals come before the delay of the server
+	cfg := asynq.Config{RetryDelayFunc: func(n int, err error, t *asynq.Task) time.Duration { return time.Hour }}
+	Register(asynq.NewServeMux(), &cfg)
+	assert.Equal(t, time.Minute, cfg.RetryDelayFunc(1, tasks.Defer(errors.New("over cap"), time.Minute), nil))
+	assert.Equal(t, time.Hour, cfg.RetryDelayFunc(1, errors.New("failed"), nil))
+}
+
+type ctxKey struct{}
+
+func TestBaseContext(t *testing.T) {
+	cfg := Config{
+		Clients: []eclient.Ethclient{eclient.NewEthclientPool("sepolia", "http://127.0.0.1:8545")},
+		Wallet:  keystore.NewKeyStore(t.TempDir(), keystore.LightScryptN, keystore.LightScryptP),
+	}
+	calls := 0
+	fn := baseContext(cfg, newOptions([]Option{WithContext(func(ctx context.Context) context.Context {
+		calls++
+		return context.WithValue(ctx, ctxKey{}, "installed")
+	})}))
+	ctx := fn()
+	_, ok := pool.GetClient(ctx, "sepolia")
+	assert.True(t, ok)
+	assert.Equal(t, "installed", ctx.Value(ctxKey{}))
+	assert.Equal(t, ctx, fn())
+	assert.Equal(t, 1, calls)
+}